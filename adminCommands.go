@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackupDirectory = "./backups"
+	// a Telegram message can't be longer than 4096 characters
+	maxListedSessions     = 30
+	maxListedAuditRecords = 20
+	// in characters, the broadcast texts can be long
+	maxListedAuditDetailsLength = 100
+	// Telegram doesn't let bots send more than about 30 messages per second
+	broadcastMessageInterval = 50 * time.Millisecond
+)
+
+func makeAdminCommandProcessors() ProcessorFuncMap {
+	return map[string]ProcessorFunc{
+		"backup":        backupCommand,
+		"reload":        reloadCommand,
+		"sessions":      sessionsCommand,
+		"stats":         statsCommand,
+		"broadcast":     broadcastCommand,
+		"close_session": closeSessionCommand,
+		"audit":         auditCommand,
+	}
+}
+
+// adminOnly makes the command look like an unknown command for everyone except admins,
+// the commands of the admins are recorded to the audit log
+func adminOnly(processor ProcessorFunc) ProcessorFunc {
+	return func(data *processing.ProcessData) {
+		if !staticFunctions.IsAdmin(data.Static, data.ChatId) {
+			log.Printf("User %d tried to run an admin command %s", data.ChatId, data.Command)
+			data.SendMessage(data.Trans("help_info"), true)
+			return
+		}
+		staticFunctions.GetDb(data.Static).AddAdminAuditRecord(data.ChatId, data.Command, data.Message)
+		processor(data)
+	}
+}
+
+const adminJobsKey = "adminJobs"
+
+// adminJobs runs the long admin commands outside of the worker of the admin,
+// otherwise the next updates of the admin would be dropped and the shutdown would wait for them
+type adminJobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+}
+
+func makeAdminJobs() *adminJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &adminJobs{ctx: ctx, cancel: cancel}
+}
+
+// getAdminJobs returns the jobs stored by makeStaticData
+func getAdminJobs(staticData *processing.StaticProccessStructs) *adminJobs {
+	jobs, _ := staticData.GetCustomValue(adminJobsKey).(*adminJobs)
+	return jobs
+}
+
+func (jobs *adminJobs) run(job func(ctx context.Context)) {
+	jobs.jobs.Add(1)
+	go func() {
+		defer jobs.jobs.Done()
+		job(jobs.ctx)
+	}()
+}
+
+// stop asks the running jobs to finish early
+func (jobs *adminJobs) stop() {
+	jobs.cancel()
+}
+
+func (jobs *adminJobs) wait() {
+	jobs.jobs.Wait()
+}
+
+func makeBackupPath(directory string) string {
+	return filepath.Join(directory, "bot-data-"+time.Now().Format("20060102-150405")+".db")
+}
+
+func backupCommand(data *processing.ProcessData) {
+	config, _ := staticFunctions.GetConfig(data.Static)
+
+	directory := config.BackupDirectory
+	if directory == "" {
+		directory = defaultBackupDirectory
+	}
+
+	err := os.MkdirAll(directory, 0700)
+	if err == nil {
+		path := makeBackupPath(directory)
+		err = staticFunctions.GetDb(data.Static).Backup(path)
+		if err == nil {
+			log.Printf("Admin %d made a backup %s", data.ChatId, path)
+			data.SendMessage(data.Trans("backup_created", map[string]interface{}{
+				"Path": path,
+			}), true)
+			return
+		}
+	}
+
+	log.Printf("Backup failed: %s", err.Error())
+	data.SendMessage(data.Trans("backup_failed", map[string]interface{}{
+		"Error": err.Error(),
+	}), true)
+}
+
+func reloadCommand(data *processing.ProcessData) {
+	configReloader, ok := data.Static.GetCustomValue(reloaderKey).(*reloader)
+	if !ok || configReloader == nil {
+		log.Print("Reloader is not set")
+		return
+	}
+
+	problems := configReloader.reload()
+	if len(problems) > 0 {
+		data.SendMessage(data.Trans("reload_failed", map[string]interface{}{
+			"Problems": html.EscapeString(strings.Join(problems, "\n")),
+		}), true)
+		return
+	}
+
+	log.Printf("Admin %d reloaded the configuration", data.ChatId)
+	data.Trans = staticFunctions.FindTransFunction(data.UserId, data.Static)
+	data.SendMessage(data.Trans("reload_succeeded"), true)
+}
+
+func sessionsCommand(data *processing.ProcessData) {
+	sessions := staticFunctions.GetDb(data.Static).GetActiveSessions(maxListedSessions)
+	if len(sessions) == 0 {
+		data.SendMessage(data.Trans("admin_no_sessions"), true)
+		return
+	}
+
+	now := time.Now().Unix()
+	lines := []string{data.Trans("admin_sessions_title", map[string]interface{}{
+		"Count": len(sessions),
+	})}
+	for _, session := range sessions {
+		line := data.Trans("admin_session_line", map[string]interface{}{
+			"Id":          session.Id,
+			"Players":     session.PlayersCount,
+			"IdleMinutes": max(now-session.LastActivity, 0) / 60,
+		})
+		if session.IsWebHosted {
+			line += " " + data.Trans("admin_session_web")
+		}
+		if session.IsGroup {
+			line += " " + data.Trans("admin_session_group")
+		}
+		lines = append(lines, line)
+	}
+
+	data.SendMessage(strings.Join(lines, "\n"), true)
+}
+
+func statsCommand(data *processing.ProcessData) {
+	dbStats := staticFunctions.GetDb(data.Static).GetStats()
+	workers := getWorkerStats(data.Static)
+
+	var webSubscribers int
+	if broker := staticFunctions.GetWebEventsBroker(data.Static); broker != nil {
+		webSubscribers = broker.GetSubscribersCount()
+	}
+
+	data.SendMessage(data.Trans("admin_stats", map[string]interface{}{
+		"Sessions":       dbStats.Sessions,
+		"Players":        dbStats.Players,
+		"TelegramUsers":  dbStats.TelegramUsers,
+		"WebUsers":       dbStats.WebUsers,
+		"OpenWebPages":   webSubscribers,
+		"ActiveWorkers":  workers.activeWorkers.Load(),
+		"StartedWorkers": workers.startedWorkers.Load(),
+		"EvictedWorkers": workers.evictedWorkers.Load(),
+		"DroppedUpdates": workers.droppedUpdates.Load(),
+	}), true)
+}
+
+// broadcastCommand sends the text to every user in their language, e.g. to warn about maintenance,
+// the messages are sent in the background to not block the updates of the admin
+func broadcastCommand(data *processing.ProcessData) {
+	text := strings.TrimSpace(data.Message)
+	if text == "" {
+		data.SendMessage(data.Trans("admin_broadcast_usage"), true)
+		return
+	}
+
+	jobs := getAdminJobs(data.Static)
+	if jobs == nil {
+		log.Print("Admin jobs are not set")
+		return
+	}
+
+	recipients := staticFunctions.GetDb(data.Static).GetBroadcastRecipients()
+	data.SendMessage(data.Trans("admin_broadcast_started", map[string]interface{}{
+		"Total": len(recipients),
+	}), true)
+
+	staticData := data.Static
+	adminChatId := data.ChatId
+	trans := data.Trans
+	jobs.run(func(ctx context.Context) {
+		sentCount, isCompleted := sendBroadcast(ctx, staticData, recipients, text)
+		log.Printf("Admin %d sent a broadcast to %d of %d users", adminChatId, sentCount, len(recipients))
+
+		textId := "admin_broadcast_sent"
+		if !isCompleted {
+			textId = "admin_broadcast_stopped"
+		}
+		staticData.Chat.SendMessage(adminChatId, trans(textId, map[string]interface{}{
+			"Sent":  sentCount,
+			"Total": len(recipients),
+		}), 0, true)
+	})
+}
+
+// sendBroadcast stops early if the bot is shutting down
+func sendBroadcast(ctx context.Context, staticData *processing.StaticProccessStructs, recipients []database.BroadcastRecipient, text string) (sentCount int, isCompleted bool) {
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			return
+		}
+
+		trans := staticFunctions.GetTranslator(staticData, recipient.Language)
+		message := trans("broadcast_message", map[string]interface{}{
+			"Text": html.EscapeString(text),
+		})
+
+		if recipient.ChatId == 0 {
+			staticFunctions.SendWebMessage(staticData, recipient.UserId, message)
+			sentCount++
+			continue
+		}
+
+		if staticData.Chat.SendMessage(recipient.ChatId, message, 0, true) != 0 {
+			sentCount++
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(broadcastMessageInterval):
+		}
+	}
+	return sentCount, true
+}
+
+func closeSessionCommand(data *processing.ProcessData) {
+	sessionId, err := strconv.ParseInt(strings.TrimSpace(data.Message), 10, 64)
+	if err != nil {
+		data.SendMessage(data.Trans("admin_close_session_usage"), true)
+		return
+	}
+
+	if !staticFunctions.CloseSessionByAdmin(data.Static, sessionId) {
+		data.SendMessage(data.Trans("admin_session_not_found"), true)
+		return
+	}
+
+	log.Printf("Admin %d closed session %d", data.ChatId, sessionId)
+	data.SendMessage(data.Trans("admin_session_closed", map[string]interface{}{
+		"Id": sessionId,
+	}), true)
+}
+
+// auditCommand shows the latest admin commands, the newest first
+func auditCommand(data *processing.ProcessData) {
+	records := staticFunctions.GetDb(data.Static).GetRecentAdminAuditRecords(maxListedAuditRecords)
+
+	lines := []string{data.Trans("admin_audit_title", map[string]interface{}{
+		"Count": len(records),
+	})}
+	for _, record := range records {
+		details := []rune(record.Details)
+		if len(details) > maxListedAuditDetailsLength {
+			details = append(details[:maxListedAuditDetailsLength], '…')
+		}
+
+		lines = append(lines, data.Trans("admin_audit_line", map[string]interface{}{
+			"Time":    time.Unix(record.Time, 0).UTC().Format("2006-01-02 15:04"),
+			"Admin":   record.AdminChatId,
+			"Command": html.EscapeString(record.Action),
+			"Details": html.EscapeString(string(details)),
+		}))
+	}
+
+	data.SendMessage(strings.Join(lines, "\n"), true)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// the limitations of Telegram for the commands in the menu
+const maxCommandDescriptionLength = 256
+
+var menuCommandRegexp = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// the scopes of the chats where the commands are shown
+const (
+	privateChatsScope = "all_private_chats"
+	groupChatsScope   = "all_group_chats"
+)
+
+func getCommandDescriptionId(command string) string {
+	return "command_desc_" + command
+}
+
+// makeBotCommands describes the commands for the menu of Telegram, the commands are taken from the processors
+// so every new command gets to the menu, the admin commands are not shown
+func makeBotCommands(processors ProcessorFuncMap, trans i18n.TranslateFunc) (commands []transport.BotCommand) {
+	for command := range processors {
+		commands = append(commands, transport.BotCommand{
+			Command:     command,
+			Description: trans(getCommandDescriptionId(command)),
+		})
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Command < commands[j].Command
+	})
+	return
+}
+
+// validateCommandDescriptions checks that the menu of every language can be sent to Telegram
+func validateCommandDescriptions(config *static.StaticConfiguration, translators map[string]i18n.TranslateFunc) (problems []string) {
+	processorsOfScopes := []ProcessorFuncMap{makeUserCommandProcessors(), makeGroupCommandProcessors()}
+
+	for _, processors := range processorsOfScopes {
+		for command := range processors {
+			if !menuCommandRegexp.MatchString(command) {
+				problems = append(problems, fmt.Sprintf("command /%s can't be shown in the menu, it should be 1-32 characters long and contain only a-z, 0-9 and _", command))
+			}
+		}
+	}
+
+	for _, lang := range config.AvailableLanguages {
+		trans, isLoaded := translators[lang.Key]
+		if !isLoaded {
+			// already reported as a loading problem
+			continue
+		}
+
+		for _, processors := range processorsOfScopes {
+			for _, command := range makeBotCommands(processors, trans) {
+				descriptionId := getCommandDescriptionId(command.Command)
+				length := utf8.RuneCountInString(command.Description)
+				if command.Description == descriptionId {
+					problems = append(problems, fmt.Sprintf("no translation \"%s\" in %s", descriptionId, lang.Key))
+				} else if length == 0 || length > maxCommandDescriptionLength {
+					problems = append(problems, fmt.Sprintf("%s in %s should be 1-%d characters long", descriptionId, lang.Key, maxCommandDescriptionLength))
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// getMenuLanguageCode gives the two-letter code that Telegram uses for the language of the user, e.g. "en" for "en-us"
+func getMenuLanguageCode(langKey string) string {
+	code, _, _ := strings.Cut(strings.ToLower(langKey), "-")
+	return code
+}
+
+// publishBotCommands replaces the menus of the commands for all the available languages,
+// the default language is also used for the users with other languages
+func publishBotCommands(telegramTransport *transport.TelegramTransport, config *static.StaticConfiguration, translators map[string]i18n.TranslateFunc) {
+	userProcessors := makeUserCommandProcessors()
+	groupProcessors := makeGroupCommandProcessors()
+
+	publish := func(trans i18n.TranslateFunc, languageCode string) {
+		err := telegramTransport.SetCommands(makeBotCommands(userProcessors, trans), privateChatsScope, languageCode)
+		if err == nil {
+			err = telegramTransport.SetCommands(makeBotCommands(groupProcessors, trans), groupChatsScope, languageCode)
+		}
+		if err != nil {
+			log.Printf("Can't publish the commands for language \"%s\": %s", languageCode, err.Error())
+		}
+	}
+
+	if trans, isLoaded := translators[config.DefaultLanguage]; isLoaded {
+		publish(trans, "")
+	}
+
+	publishedCodes := make(map[string]bool)
+	for _, lang := range config.AvailableLanguages {
+		trans, isLoaded := translators[lang.Key]
+		if !isLoaded {
+			continue
+		}
+
+		languageCode := getMenuLanguageCode(lang.Key)
+		if publishedCodes[languageCode] {
+			log.Printf("The commands for %s are not published, Telegram has one menu for the language \"%s\"", lang.Key, languageCode)
+			continue
+		}
+		publishedCodes[languageCode] = true
+
+		publish(trans, languageCode)
+	}
+
+	log.Print("Commands are published")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestBotCommandsAreTranslated(t *testing.T) {
+	assert := require.New(t)
+
+	config := makeTestBotConfig()
+	translators, _, problems := loadTranslations(config.AvailableLanguages, "./data/strings")
+	assert.Empty(problems)
+	assert.Empty(validateCommandDescriptions(&config, translators))
+
+	commands := makeBotCommands(makeUserCommandProcessors(), translators["ru-ru"])
+	assert.Len(commands, len(makeUserCommandProcessors()))
+	assert.Equal("cancel", commands[0].Command)
+	assert.Equal(translators["ru-ru"]("command_desc_cancel"), commands[0].Description)
+
+	// the admin commands are not shown to everyone
+	for _, command := range commands {
+		assert.NotEqual("backup", command.Command)
+	}
+}
+
+func TestBotCommandDescriptionProblems(t *testing.T) {
+	assert := require.New(t)
+
+	config := makeTestBotConfig()
+	translators, _, _ := loadTranslations(config.AvailableLanguages, "./data/strings")
+	translators["ru-ru"] = func(translationID string, args ...interface{}) string {
+		if translationID == "command_desc_help" {
+			return strings.Repeat("a", maxCommandDescriptionLength+1)
+		}
+		return translationID
+	}
+
+	problems := strings.Join(validateCommandDescriptions(&config, translators), "\n")
+	assert.Contains(problems, "no translation \"command_desc_start\" in ru-ru")
+	assert.Contains(problems, "no translation \"command_desc_newgame\" in ru-ru")
+	assert.Contains(problems, "command_desc_help in ru-ru should be 1-256 characters long")
+	assert.NotContains(problems, "en-us")
+}
+
+func TestMenuLanguageCode(t *testing.T) {
+	assert := require.New(t)
+	assert.Equal("en", getMenuLanguageCode("en-us"))
+	assert.Equal("ru", getMenuLanguageCode("RU-ru"))
+	assert.Equal("de", getMenuLanguageCode("de"))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"os"
+	"slices"
+	"strings"
+)
+
+func printCommandLineToolsUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  backup <file.db>     make a consistent copy of the database")
+	fmt.Fprintln(os.Stderr, "  export <file.json>   export Telegram users and their languages")
+	fmt.Fprintln(os.Stderr, "  import <file.json>   import Telegram users and their languages, creates the database if needed")
+	fmt.Fprintln(os.Stderr, "The language is the only setting that outlives the games, the sessions and web players are not exported")
+}
+
+// runCommandLineTool executes a maintenance subcommand and returns the process exit code
+func runCommandLineTool(args []string, options *launchOptions) int {
+	if len(args) != 2 {
+		printCommandLineToolsUsage()
+		return 2
+	}
+
+	command := args[0]
+	path := args[1]
+
+	if command != "backup" && command != "export" && command != "import" {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n", command)
+		printCommandLineToolsUsage()
+		return 2
+	}
+
+	dbPath := options.dbPath
+	// importing is how the data gets to a new host, there the database doesn't exist yet
+	if command != "import" {
+		if _, err := os.Stat(dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't open database: %s\n", err.Error())
+			return 1
+		}
+	}
+
+	db, err := database.ConnectDb(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't connect database: %s\n", err.Error())
+		return 1
+	}
+	defer db.Disconnect()
+
+	database.UpdateVersion(db)
+
+	switch command {
+	case "backup":
+		err = db.Backup(path)
+	case "export":
+		err = exportData(db, path)
+	case "import":
+		err = importData(db, path, options.configPath)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %s\n", command, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func exportData(db *database.SpyBotDb, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(db.ExportData())
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// normalizeImportedLanguages replaces the languages with the keys of the available ones, e.g. "ru" with "ru-ru",
+// the users with unknown languages get an empty one and will use the default language
+func normalizeImportedLanguages(config *static.StaticConfiguration, data *database.ExportedData) (unknownLanguages []string) {
+	for i := range data.TelegramUsers {
+		user := &data.TelegramUsers[i]
+		if user.Language == "" {
+			continue
+		}
+
+		langKey, isFound := staticFunctions.FindAvailableLanguage(config, user.Language)
+		if !isFound && !slices.Contains(unknownLanguages, user.Language) {
+			unknownLanguages = append(unknownLanguages, user.Language)
+		}
+		user.Language = langKey
+	}
+	return
+}
+
+func importData(db *database.SpyBotDb, path string, configPath string) error {
+	// the languages are checked against the configuration of the bot that will use the data
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %s", configPath, describeJsonError(err))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var data database.ExportedData
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&data)
+	if err != nil {
+		return err
+	}
+
+	unknownLanguages := normalizeImportedLanguages(&config, &data)
+	if len(unknownLanguages) > 0 {
+		fmt.Fprintf(os.Stderr, "Languages %s are not available, the default language will be used instead\n", strings.Join(unknownLanguages, ", "))
+	}
+
+	importedCount := db.ImportData(data)
+	fmt.Printf("Imported %d users\n", importedCount)
+	return nil
+}
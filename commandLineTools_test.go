@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportedLanguages(t *testing.T) {
+	assert := require.New(t)
+
+	config := makeTestBotConfig()
+	data := database.ExportedData{TelegramUsers: []database.ExportedTelegramUser{
+		{ChatId: 1, Language: "ru-ru"},
+		{ChatId: 2, Language: "RU"},
+		{ChatId: 3, Language: "de-de"},
+		{ChatId: 4, Language: ""},
+		{ChatId: 5, Language: "de-de"},
+	}}
+
+	assert.Equal([]string{"de-de"}, normalizeImportedLanguages(&config, &data))
+	assert.Equal("ru-ru", data.TelegramUsers[0].Language)
+	assert.Equal("ru-ru", data.TelegramUsers[1].Language)
+	assert.Equal("", data.TelegramUsers[2].Language)
+	assert.Equal("", data.TelegramUsers[3].Language)
+}
+
+func TestImportIntoNewDatabase(t *testing.T) {
+	assert := require.New(t)
+	dir := t.TempDir()
+
+	configJson, err := json.Marshal(makeTestBotConfig())
+	assert.NoError(err)
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(os.WriteFile(configPath, configJson, 0600))
+
+	exportedJson, err := json.Marshal(database.ExportedData{TelegramUsers: []database.ExportedTelegramUser{
+		{ChatId: 1, Language: "ru-ru"},
+		{ChatId: 2, Language: "en-us"},
+	}})
+	assert.NoError(err)
+	exportPath := filepath.Join(dir, "export.json")
+	assert.NoError(os.WriteFile(exportPath, exportedJson, 0600))
+
+	// the database of a new host doesn't exist before the import
+	options := &launchOptions{configPath: configPath, dbPath: filepath.Join(dir, "bot-data.db")}
+	assert.Equal(1, runCommandLineTool([]string{"backup", filepath.Join(dir, "backup.db")}, options))
+	assert.Equal(1, runCommandLineTool([]string{"export", filepath.Join(dir, "second-export.json")}, options))
+	assert.Equal(0, runCommandLineTool([]string{"import", exportPath}, options))
+
+	db, err := database.ConnectDb(options.dbPath)
+	assert.NoError(err)
+	defer db.Disconnect()
+	userId, isFound := db.FindTelegramUserId(1)
+	assert.True(isFound)
+	assert.Equal("ru-ru", db.GetUserLanguage(userId))
+}
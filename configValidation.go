@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/gameraccoon/telegram-spy-game-bot/httpServer"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var webhookSecretTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+var bindHostRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// loadAndValidateConfig collects all the problems at once so they can be fixed in one go
+func loadAndValidateConfig(options *launchOptions) (config static.StaticConfiguration, translators map[string]i18n.TranslateFunc, problems []string) {
+	config, err := loadConfig(options.configPath)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("can't read %s: %s", options.configPath, describeJsonError(err)))
+		return
+	}
+
+	translators, ids, translationProblems := loadTranslations(config.AvailableLanguages, options.stringsDir)
+	problems = append(problems, translationProblems...)
+	problems = append(problems, validateConfig(&config, ids)...)
+	problems = append(problems, validateCommandDescriptions(&config, translators)...)
+	return
+}
+
+func describeJsonError(err error) string {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		return fmt.Sprintf("%s (at byte %d)", syntaxErr.Error(), syntaxErr.Offset)
+	}
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return fmt.Sprintf("field \"%s\" should be %s, got %s", typeErr.Field, typeErr.Type.String(), typeErr.Value)
+	}
+	return err.Error()
+}
+
+func validateConfig(config *static.StaticConfiguration, ids translationIds) (problems []string) {
+	problems = append(problems, validateLanguages(config)...)
+	problems = append(problems, validateHttpServer(config)...)
+	problems = append(problems, validateWebhook(config)...)
+	problems = append(problems, validateSpyfallLocations(config, ids)...)
+	problems = append(problems, validateTranslationsCompleteness(config, ids)...)
+
+	if config.SessionIdleTimeoutMinutes < 0 || config.WebUserIdleTimeoutMinutes < 0 || config.CleanupIntervalMinutes < 0 {
+		problems = append(problems, "cleanup timeouts can't be negative")
+	}
+
+	if config.UserWorkerIdleTimeoutMinutes < 0 {
+		problems = append(problems, "userWorkerIdleTimeoutMinutes can't be negative")
+	}
+
+	if config.UserQueueSize < 0 {
+		problems = append(problems, "userQueueSize can't be negative")
+	}
+
+	if config.ApiRequestsPerMinutePerIp < 0 || config.JoinsPerMinutePerIp < 0 || config.JoinsPerMinutePerSession < 0 {
+		problems = append(problems, "rate limits can't be negative")
+	}
+
+	if config.MaxPlayersInSession < 0 {
+		problems = append(problems, "maxPlayersInSession can't be negative")
+	}
+
+	if config.MaxThemeLength < 0 {
+		problems = append(problems, "maxThemeLength can't be negative")
+	}
+
+	return
+}
+
+func validateLanguages(config *static.StaticConfiguration) (problems []string) {
+	if len(config.AvailableLanguages) == 0 {
+		return []string{"availableLanguages: need at least one language"}
+	}
+
+	keys := make(map[string]bool)
+	for i, lang := range config.AvailableLanguages {
+		if lang.Key == "" {
+			problems = append(problems, fmt.Sprintf("availableLanguages[%d]: empty key", i))
+			continue
+		}
+		if lang.Name == "" {
+			problems = append(problems, fmt.Sprintf("availableLanguages[%d]: empty name for %s", i, lang.Key))
+		}
+		if keys[lang.Key] {
+			problems = append(problems, fmt.Sprintf("availableLanguages[%d]: %s is listed twice", i, lang.Key))
+		}
+		keys[lang.Key] = true
+	}
+
+	if !keys[config.DefaultLanguage] {
+		problems = append(problems, fmt.Sprintf("defaultLanguage: \"%s\" should be in the list of available languages", config.DefaultLanguage))
+	}
+
+	return
+}
+
+func validateHttpServer(config *static.StaticConfiguration) (problems []string) {
+	if config.RunHttpServer {
+		if config.HttpServerPort <= 0 || config.HttpServerPort > 65535 {
+			problems = append(problems, fmt.Sprintf("httpServerPort: %d is not a valid port", config.HttpServerPort))
+		}
+		if config.ShareWebAddress == "" {
+			problems = append(problems, "shareWebAddress: should be set when the HTTP server is enabled")
+		}
+		problems = append(problems, validateHttpServerNetwork(config)...)
+	}
+
+	if config.ShareWebAddress != "" {
+		address, err := url.Parse(config.ShareWebAddress)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: %s", err.Error()))
+		} else if address.Scheme != "http" && address.Scheme != "https" {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: \"%s\" should start with http:// or https://", config.ShareWebAddress))
+		} else if address.Host == "" {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: \"%s\" has no host", config.ShareWebAddress))
+		} else if strings.HasSuffix(config.ShareWebAddress, "/") || address.RawQuery != "" || address.Fragment != "" {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: \"%s\" should not end with a slash or contain a query, the paths are appended to it", config.ShareWebAddress))
+		}
+	}
+
+	return
+}
+
+// validateHttpServerNetwork checks the settings that decide how the server is reached
+func validateHttpServerNetwork(config *static.StaticConfiguration) (problems []string) {
+	if config.HttpBindAddress != "" && net.ParseIP(config.HttpBindAddress) == nil && !bindHostRegexp.MatchString(config.HttpBindAddress) {
+		problems = append(problems, fmt.Sprintf("httpBindAddress: \"%s\" should be an IP address or a host name without a port", config.HttpBindAddress))
+	}
+
+	isTlsEnabled := config.TlsCertFile != "" || config.TlsKeyFile != ""
+	if isTlsEnabled {
+		if config.TlsCertFile == "" || config.TlsKeyFile == "" {
+			problems = append(problems, "tlsCertFile, tlsKeyFile: both should be set to serve HTTPS")
+		} else if _, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile); err != nil {
+			problems = append(problems, fmt.Sprintf("tlsCertFile, tlsKeyFile: %s", err.Error()))
+		}
+	}
+
+	for i, proxy := range config.TrustedProxies {
+		if _, err := httpServer.ParseTrustedProxy(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("trustedProxies[%d]: %s", i, err.Error()))
+		}
+	}
+
+	// behind a proxy the scheme of the public address is decided by the proxy
+	if len(config.TrustedProxies) == 0 {
+		address, err := url.Parse(config.ShareWebAddress)
+		if err == nil && isTlsEnabled && address.Scheme == "http" {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: \"%s\" should start with https:// as the server serves HTTPS", config.ShareWebAddress))
+		} else if err == nil && !isTlsEnabled && address.Scheme == "https" {
+			problems = append(problems, fmt.Sprintf("shareWebAddress: \"%s\" is https:// but the server serves plain HTTP, set tlsCertFile and tlsKeyFile or trustedProxies", config.ShareWebAddress))
+		}
+	}
+
+	return
+}
+
+func validateWebhook(config *static.StaticConfiguration) (problems []string) {
+	if !config.UseWebhook {
+		return
+	}
+
+	if !config.RunHttpServer {
+		problems = append(problems, "useWebhook: the webhook needs runHttpServer to be enabled")
+	}
+
+	webhookUrl, err := url.Parse(config.WebhookUrl)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("webhookUrl: %s", err.Error()))
+	} else if webhookUrl.Scheme != "https" || webhookUrl.Host == "" {
+		problems = append(problems, fmt.Sprintf("webhookUrl: \"%s\" should be an https:// address", config.WebhookUrl))
+	}
+
+	if config.WebhookPath != "" && !strings.HasPrefix(config.WebhookPath, "/") {
+		problems = append(problems, fmt.Sprintf("webhookPath: \"%s\" should start with a slash", config.WebhookPath))
+	} else if getWebhookPath(config) == "/" {
+		problems = append(problems, "webhookPath: the webhook can't use the root path, it is taken by the web pages")
+	}
+
+	// the limitations of Telegram for the secret token
+	if !webhookSecretTokenRegexp.MatchString(config.WebhookSecretToken) {
+		problems = append(problems, "webhookSecretToken: should be 1-256 characters long and contain only A-Z, a-z, 0-9, _ and -")
+	}
+
+	return
+}
+
+func validateSpyfallLocations(config *static.StaticConfiguration, ids translationIds) (problems []string) {
+	if len(config.SpyfallLocations) == 0 {
+		return []string{"spyfallLocations: the list is empty"}
+	}
+
+	locationIds := make(map[string]bool)
+	for i, location := range config.SpyfallLocations {
+		if location.LocationId == "" {
+			problems = append(problems, fmt.Sprintf("spyfallLocations[%d]: empty locationId", i))
+			continue
+		}
+		if locationIds[location.LocationId] {
+			problems = append(problems, fmt.Sprintf("spyfallLocations[%d]: %s is listed twice", i, location.LocationId))
+		}
+		locationIds[location.LocationId] = true
+
+		if len(location.Roles) == 0 {
+			problems = append(problems, fmt.Sprintf("spyfallLocations[%d]: %s has no roles", i, location.LocationId))
+		}
+
+		requiredIds := []string{"spyfall_loc_" + location.LocationId}
+		for _, role := range location.Roles {
+			requiredIds = append(requiredIds, "spyfall_role_"+location.LocationId+"_"+role)
+		}
+
+		for _, lang := range config.AvailableLanguages {
+			langIds, isLoaded := ids[lang.Key]
+			if !isLoaded {
+				// already reported as a loading problem
+				continue
+			}
+			for _, id := range requiredIds {
+				if !langIds[id] {
+					problems = append(problems, fmt.Sprintf("spyfallLocations[%d]: no translation \"%s\" in %s", i, id, lang.Key))
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// validateTranslationsCompleteness checks that every language has all the strings of the default language
+func validateTranslationsCompleteness(config *static.StaticConfiguration, ids translationIds) (problems []string) {
+	defaultIds, isLoaded := ids[config.DefaultLanguage]
+	if !isLoaded {
+		return
+	}
+
+	for _, lang := range config.AvailableLanguages {
+		langIds, isLoaded := ids[lang.Key]
+		if !isLoaded || lang.Key == config.DefaultLanguage {
+			continue
+		}
+
+		var missingIds []string
+		for id := range defaultIds {
+			if !langIds[id] {
+				missingIds = append(missingIds, id)
+			}
+		}
+
+		if len(missingIds) > 0 {
+			sort.Strings(missingIds)
+			problems = append(problems, fmt.Sprintf("%s misses translations: %s", lang.Key, strings.Join(missingIds, ", ")))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func makeValidTestConfig() (static.StaticConfiguration, translationIds) {
+	config := static.StaticConfiguration{
+		AvailableLanguages: []static.LanguageData{{Key: "en-us", Name: "English"}, {Key: "ru-ru", Name: "Русский"}},
+		DefaultLanguage:    "en-us",
+		SpyfallLocations:   []static.SpyfallLocation{{LocationId: "bank", Roles: []string{"guard"}}},
+		RunHttpServer:      true,
+		HttpServerPort:     8080,
+		ShareWebAddress:    "https://example.com",
+		TrustedProxies:     []string{"127.0.0.1"},
+	}
+	ids := translationIds{
+		"en-us": {"spyfall_loc_bank": true, "spyfall_role_bank_guard": true},
+		"ru-ru": {"spyfall_loc_bank": true, "spyfall_role_bank_guard": true},
+	}
+	return config, ids
+}
+
+func TestValidConfig(t *testing.T) {
+	config, ids := makeValidTestConfig()
+	require.Empty(t, validateConfig(&config, ids))
+}
+
+func TestConfigProblemsAreAllReported(t *testing.T) {
+	assert := require.New(t)
+	config, ids := makeValidTestConfig()
+
+	config.DefaultLanguage = "de"
+	config.HttpServerPort = 70000
+	config.ShareWebAddress = "example.com/"
+	delete(ids["ru-ru"], "spyfall_role_bank_guard")
+	config.JoinsPerMinutePerIp = -1
+	config.MaxPlayersInSession = -5
+
+	problems := strings.Join(validateConfig(&config, ids), "\n")
+	assert.Contains(problems, "defaultLanguage")
+	assert.Contains(problems, "httpServerPort")
+	assert.Contains(problems, "shareWebAddress")
+	assert.Contains(problems, "no translation \"spyfall_role_bank_guard\" in ru-ru")
+	assert.Contains(problems, "rate limits")
+	assert.Contains(problems, "maxPlayersInSession")
+}
+
+func TestStrictConfigDecoding(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config.json"
+	require.NoError(t, writeTestFile(path, `{"httpServerPrt": 8080}`))
+
+	_, err := loadConfig(path)
+	require.ErrorContains(t, err, "unknown field \"httpServerPrt\"")
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	assert := require.New(t)
+	config, ids := makeValidTestConfig()
+
+	config.UseWebhook = true
+	config.WebhookUrl = "https://example.com/telegram-webhook"
+	config.WebhookSecretToken = "secret_token-1"
+	assert.Empty(validateConfig(&config, ids))
+	assert.Equal("/telegram-webhook", getWebhookPath(&config))
+
+	config.WebhookPath = "/hook"
+	assert.Equal("/hook", getWebhookPath(&config))
+
+	config.WebhookUrl = "http://example.com"
+	config.WebhookPath = ""
+	config.WebhookSecretToken = "not a valid token"
+	problems := strings.Join(validateConfig(&config, ids), "\n")
+	assert.Contains(problems, "webhookUrl")
+	assert.Contains(problems, "webhookPath")
+	assert.Contains(problems, "webhookSecretToken")
+}
+
+func TestHttpServerNetworkConfigValidation(t *testing.T) {
+	assert := require.New(t)
+	config, ids := makeValidTestConfig()
+
+	config.HttpBindAddress = "127.0.0.1"
+	config.TrustedProxies = []string{"10.0.0.0/8", "::1"}
+	assert.Empty(validateConfig(&config, ids))
+
+	config.HttpBindAddress = "localhost:8080"
+	config.TrustedProxies = []string{"10.0.0.0/33", "proxy"}
+	problems := strings.Join(validateConfig(&config, ids), "\n")
+	assert.Contains(problems, "httpBindAddress")
+	assert.Contains(problems, "trustedProxies[0]")
+	assert.Contains(problems, "trustedProxies[1]")
+
+	// without a proxy the scheme should be the one the server serves
+	config, ids = makeValidTestConfig()
+	config.TrustedProxies = nil
+	assert.Contains(strings.Join(validateConfig(&config, ids), "\n"), "serves plain HTTP")
+
+	config.TlsCertFile = "cert.pem"
+	problems = strings.Join(validateConfig(&config, ids), "\n")
+	assert.Contains(problems, "both should be set")
+	assert.NotContains(problems, "shareWebAddress")
+
+	config.TlsKeyFile = "key.pem"
+	config.ShareWebAddress = "http://example.com"
+	problems = strings.Join(validateConfig(&config, ids), "\n")
+	assert.Contains(problems, "tlsCertFile, tlsKeyFile: open cert.pem")
+	assert.Contains(problems, "should start with https://")
+}
@@ -0,0 +1,8 @@
+package data
+
+import "embed"
+
+// HtmlFiles are the web pages built into the binary, the "html" directory in it
+//
+//go:embed html/*.html
+var HtmlFiles embed.FS
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"fmt"
+	dbBase "github.com/gameraccoon/telegram-bot-skeleton/database"
+	"log"
+)
+
+type SessionInfo struct {
+	Id           int64
+	PlayersCount int64
+	// unix time
+	LastActivity int64
+	IsWebHosted  bool
+	IsGroup      bool
+}
+
+type BroadcastRecipient struct {
+	UserId int64
+	// zero for web players
+	ChatId   int64
+	Language string
+}
+
+type BotStats struct {
+	Sessions      int64
+	TelegramUsers int64
+	WebUsers      int64
+	// the users who are in a session now
+	Players int64
+}
+
+type AdminAuditRecord struct {
+	// unix time
+	Time        int64
+	AdminChatId int64
+	Action      string
+	Details     string
+}
+
+// GetActiveSessions returns the sessions with the most recent activity first
+func (database *SpyBotDb) GetActiveSessions(limit int) (sessions []SessionInfo) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT sessions.id, (SELECT COUNT(*) FROM users WHERE current_session=sessions.id), sessions.last_activity, sessions.is_web_hosted, group_sessions.id IS NOT NULL FROM sessions LEFT JOIN group_sessions ON sessions.id=group_sessions.session_id ORDER BY sessions.last_activity DESC, sessions.id DESC LIMIT %d", limit))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var session SessionInfo
+		err := rows.Scan(&session.Id, &session.PlayersCount, &session.LastActivity, &session.IsWebHosted, &session.IsGroup)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		sessions = append(sessions, session)
+	}
+
+	return
+}
+
+// GetBroadcastRecipients returns all the Telegram users and the web players
+func (database *SpyBotDb) GetBroadcastRecipients() (recipients []BroadcastRecipient) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query("SELECT user_id, chat_id, language FROM telegram_users" +
+		" UNION ALL SELECT user_id, 0, IFNULL(language, '') FROM web_users ORDER BY user_id")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var recipient BroadcastRecipient
+		err := rows.Scan(&recipient.UserId, &recipient.ChatId, &recipient.Language)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return
+}
+
+func (database *SpyBotDb) GetStats() (stats BotStats) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query("SELECT (SELECT COUNT(*) FROM sessions), (SELECT COUNT(*) FROM telegram_users)," +
+		" (SELECT COUNT(*) FROM web_users), (SELECT COUNT(*) FROM users WHERE current_session IS NOT NULL)")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	if rows.Next() {
+		err := rows.Scan(&stats.Sessions, &stats.TelegramUsers, &stats.WebUsers, &stats.Players)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	} else {
+		err = rows.Err()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func (database *SpyBotDb) AddAdminAuditRecord(adminChatId int64, action string, details string) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec(fmt.Sprintf("INSERT INTO admin_audit_log (time, admin_chat_id, action, details) VALUES (strftime('%%s', 'now'), %d, '%s', '%s')",
+		adminChatId, dbBase.SanitizeString(action), dbBase.SanitizeString(details)))
+}
+
+// GetRecentAdminAuditRecords returns the latest records first
+func (database *SpyBotDb) GetRecentAdminAuditRecords(limit int) (records []AdminAuditRecord) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT time, admin_chat_id, action, details FROM admin_audit_log ORDER BY id DESC LIMIT %d", limit))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var record AdminAuditRecord
+		err := rows.Scan(&record.Time, &record.AdminChatId, &record.Action, &record.Details)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		records = append(records, record)
+	}
+
+	return
+}
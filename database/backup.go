@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"log"
+	"os"
+)
+
+type ExportedTelegramUser struct {
+	ChatId   int64  `json:"chatId"`
+	Language string `json:"language"`
+}
+
+// ExportedData contains the data that should survive moving the bot to another host
+// sessions are not exported since they don't live long
+type ExportedData struct {
+	Version       string                 `json:"version"`
+	TelegramUsers []ExportedTelegramUser `json:"telegramUsers"`
+}
+
+// Backup makes a consistent copy of the database using SQLite online backup API
+func (database *SpyBotDb) Backup(destinationPath string) (err error) {
+	if _, err = os.Stat(destinationPath); err == nil {
+		return fmt.Errorf("file %s already exists", destinationPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	if !database.db.IsConnectionOpened() {
+		return errors.New("database is closed")
+	}
+
+	sourceDb, err := sql.Open("sqlite3", database.path)
+	if err != nil {
+		return
+	}
+	defer sourceDb.Close()
+
+	destinationDb, err := sql.Open("sqlite3", destinationPath)
+	if err != nil {
+		return
+	}
+	defer destinationDb.Close()
+
+	ctx := context.Background()
+
+	sourceConn, err := sourceDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer sourceConn.Close()
+
+	destinationConn, err := destinationDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer destinationConn.Close()
+
+	return destinationConn.Raw(func(destinationDriverConn interface{}) error {
+		return sourceConn.Raw(func(sourceDriverConn interface{}) error {
+			destinationSqliteConn, ok := destinationDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("unexpected destination connection type")
+			}
+			sourceSqliteConn, ok := sourceDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("unexpected source connection type")
+			}
+
+			backup, err := destinationSqliteConn.Backup("main", sourceSqliteConn, "main")
+			if err != nil {
+				return err
+			}
+
+			// copy all the pages in one step to get a consistent snapshot
+			_, err = backup.Step(-1)
+			if err != nil {
+				backup.Finish()
+				return err
+			}
+
+			return backup.Finish()
+		})
+	})
+}
+
+func (database *SpyBotDb) ExportData() (data ExportedData) {
+	data.Version = database.GetDatabaseVersion()
+
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query("SELECT chat_id, language FROM telegram_users ORDER BY id")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	data.TelegramUsers = make([]ExportedTelegramUser, 0)
+	for rows.Next() {
+		var user ExportedTelegramUser
+		err := rows.Scan(&user.ChatId, &user.Language)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		data.TelegramUsers = append(data.TelegramUsers, user)
+	}
+
+	return
+}
+
+// ImportData adds users that don't exist yet and updates languages of the existing ones
+func (database *SpyBotDb) ImportData(data ExportedData) (importedCount int) {
+	for _, user := range data.TelegramUsers {
+		userId := database.GetOrCreateTelegramUserId(user.ChatId, user.Language)
+		database.SetUserLanguage(userId, user.Language)
+		importedCount++
+	}
+	return
+}
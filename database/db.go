@@ -1,6 +1,10 @@
 package database
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	dbBase "github.com/gameraccoon/telegram-bot-skeleton/database"
 	_ "github.com/mattn/go-sqlite3"
@@ -8,9 +12,17 @@ import (
 	"sync"
 )
 
+// 128 bits, session tokens are in the invite links and can't be guessed
+const sessionTokenBytes = 16
+
+// SessionTokenLength is the length of the session tokens in the invite links
+var SessionTokenLength = base64.RawURLEncoding.EncodedLen(sessionTokenBytes)
+
 type SpyBotDb struct {
 	db    dbBase.Database
 	mutex sync.Mutex
+	// the file is needed to make online backups
+	path string
 }
 
 func init() {
@@ -18,7 +30,9 @@ func init() {
 }
 
 func ConnectDb(path string) (database *SpyBotDb, err error) {
-	database = &SpyBotDb{}
+	database = &SpyBotDb{
+		path: path,
+	}
 
 	err = database.db.Connect(path)
 
@@ -35,6 +49,9 @@ func ConnectDb(path string) (database *SpyBotDb, err error) {
 	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
 		" sessions(id INTEGER NOT NULL PRIMARY KEY" +
 		",token TEXT NOT NULL" +
+		",last_activity INTEGER NOT NULL DEFAULT 0" +
+		// sessions created from the web client live while they have any players
+		",is_web_hosted INTEGER NOT NULL DEFAULT 0" +
 		")")
 
 	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
@@ -57,7 +74,10 @@ func ConnectDb(path string) (database *SpyBotDb, err error) {
 	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
 		" web_users(id INTEGER NOT NULL PRIMARY KEY" +
 		",user_id INTEGER UNIQUE NOT NULL" +
-		",token INTEGER UNIQUE NOT NULL" +
+		// SHA-256 of the player token, the token itself is not stored
+		",token TEXT UNIQUE NOT NULL" +
+		",last_activity INTEGER NOT NULL DEFAULT 0" +
+		",language TEXT" +
 		")")
 
 	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
@@ -67,6 +87,24 @@ func ConnectDb(path string) (database *SpyBotDb, err error) {
 		",message TEXT NOT NULL" +
 		")")
 
+	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
+		" group_sessions(id INTEGER NOT NULL PRIMARY KEY" +
+		",session_id INTEGER UNIQUE NOT NULL" +
+		",chat_id INTEGER UNIQUE NOT NULL" +
+		// the message with the button to join
+		",message_id INTEGER" +
+		// the public messages are in the language of the player who started the game
+		",language TEXT NOT NULL" +
+		")")
+
+	database.db.Exec("CREATE TABLE IF NOT EXISTS" +
+		" admin_audit_log(id INTEGER NOT NULL PRIMARY KEY" +
+		",time INTEGER NOT NULL" +
+		",admin_chat_id INTEGER NOT NULL" +
+		",action TEXT NOT NULL" +
+		",details TEXT NOT NULL" +
+		")")
+
 	database.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS" +
 		" token_index ON sessions(token)")
 
@@ -91,6 +129,22 @@ func ConnectDb(path string) (database *SpyBotDb, err error) {
 	return
 }
 
+// GenerateToken returns a random string that can be used in URLs and in Telegram deep links
+func GenerateToken(bytesCount int) string {
+	buffer := make([]byte, bytesCount)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// a leaked database doesn't let anyone play as the web users
+func hashWebUserToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func (database *SpyBotDb) IsConnectionOpened() bool {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
@@ -148,8 +202,8 @@ func (database *SpyBotDb) GetOrCreateTelegramUserId(chatId int64, userLangCode s
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	// first try to find an existing user
-	rows, err := database.db.Query(fmt.Sprintf("SELECT id FROM telegram_users WHERE chat_id=%d", chatId))
+	// first try to find an existing user, the user id is users.id, not the id of the telegram_users record
+	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id, language FROM telegram_users WHERE chat_id=%d", chatId))
 	if err != nil {
 		log.Fatal(err.Error())
 		return
@@ -162,11 +216,21 @@ func (database *SpyBotDb) GetOrCreateTelegramUserId(chatId int64, userLangCode s
 	}()
 
 	if rows.Next() {
-		// user is found, we don't need to do anything, return the id
-		err := rows.Scan(&userId)
+		var language string
+		err := rows.Scan(&userId, &language)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		// the language was reset by the database update or the client didn't send it before
+		if language == "" && userLangCode != "" {
+			database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK telegram_users SET language='%s' WHERE user_id=%d", dbBase.SanitizeString(userLangCode), userId))
+		}
 		return
 	}
 
@@ -180,7 +244,34 @@ func (database *SpyBotDb) GetOrCreateTelegramUserId(chatId int64, userLangCode s
 	userId = database.getLastInsertedItemId()
 
 	database.db.Exec(fmt.Sprintf("INSERT INTO telegram_users(user_id, chat_id, language) "+
-		"VALUES (%d, %d, '%s')", userId, chatId, userLangCode))
+		"VALUES (%d, %d, '%s')", userId, chatId, dbBase.SanitizeString(userLangCode)))
+
+	return
+}
+
+// FindTelegramUserId doesn't create the user, e.g. for the inline queries from the users who never started the bot
+func (database *SpyBotDb) FindTelegramUserId(chatId int64) (userId int64, isFound bool) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id FROM telegram_users WHERE chat_id=%d", chatId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	if rows.Next() {
+		err := rows.Scan(&userId)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		isFound = true
+	}
 
 	return
 }
@@ -242,18 +333,22 @@ func (database *SpyBotDb) getLastInsertedItemId() (id int64) {
 	return -1
 }
 
+// SetUserLanguage works for both Telegram and web users
 func (database *SpyBotDb) SetUserLanguage(userId int64, language string) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK telegram_users SET language='%s' WHERE id=%d", language, userId))
+	safeLanguage := dbBase.SanitizeString(language)
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK telegram_users SET language='%s' WHERE user_id=%d", safeLanguage, userId))
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK web_users SET language='%s' WHERE user_id=%d", safeLanguage, userId))
 }
 
 func (database *SpyBotDb) GetUserLanguage(userId int64) (language string) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	rows, err := database.db.Query(fmt.Sprintf("SELECT language FROM telegram_users WHERE id=%d AND language IS NOT NULL", userId))
+	rows, err := database.db.Query(fmt.Sprintf("SELECT language FROM telegram_users WHERE user_id=%d AND language IS NOT NULL"+
+		" UNION ALL SELECT language FROM web_users WHERE user_id=%d AND language IS NOT NULL", userId, userId))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -284,6 +379,10 @@ func (database *SpyBotDb) GetUserSession(userId int64) (sessionId int64, isInSes
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
+	return database.getUserSessionUnsafe(userId)
+}
+
+func (database *SpyBotDb) getUserSessionUnsafe(userId int64) (sessionId int64, isInSession bool) {
 	rows, err := database.db.Query(fmt.Sprintf("SELECT current_session FROM users WHERE id=%d AND current_session IS NOT NULL", userId))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -316,6 +415,10 @@ func (database *SpyBotDb) DoesSessionExist(sessionId int64) (isExists bool) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
+	return database.doesSessionExistUnsafe(sessionId)
+}
+
+func (database *SpyBotDb) doesSessionExistUnsafe(sessionId int64) (isExists bool) {
 	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM sessions WHERE id=%d LIMIT 1", sessionId))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -338,7 +441,7 @@ func (database *SpyBotDb) CreateSession(userId int64) (sessionId int64, previous
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	database.db.Exec("INSERT INTO sessions (token) VALUES (strftime('%s', 'now') || '-' || abs(random() % 100000))")
+	database.db.Exec(fmt.Sprintf("INSERT INTO sessions (token, last_activity) VALUES ('%s', strftime('%%s', 'now'))", GenerateToken(sessionTokenBytes)))
 
 	sessionId = database.getLastInsertedItemId()
 
@@ -347,6 +450,151 @@ func (database *SpyBotDb) CreateSession(userId int64) (sessionId int64, previous
 	return
 }
 
+type GroupChat struct {
+	ChatId    int64
+	MessageId int64
+	Language  string
+}
+
+// CreateGroupSession creates a session bound to a group chat, the previous game of the group goes on
+// without the group or is removed if nobody joined it
+func (database *SpyBotDb) CreateGroupSession(groupChatId int64, language string) (sessionId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	previousSessionId, hadSession := database.getGroupSessionUnsafe(groupChatId)
+	if hadSession {
+		database.db.Exec(fmt.Sprintf("DELETE FROM group_sessions WHERE chat_id=%d", groupChatId))
+		database.removeSessionIfAbandonedUnsafe(previousSessionId)
+	}
+
+	database.db.Exec(fmt.Sprintf("INSERT INTO sessions (token, last_activity) VALUES ('%s', strftime('%%s', 'now'))", GenerateToken(sessionTokenBytes)))
+
+	sessionId = database.getLastInsertedItemId()
+
+	database.db.Exec(fmt.Sprintf("INSERT INTO group_sessions (session_id, chat_id, language) VALUES (%d, %d, '%s')", sessionId, groupChatId, dbBase.SanitizeString(language)))
+
+	return
+}
+
+func (database *SpyBotDb) getGroupSessionUnsafe(groupChatId int64) (sessionId int64, isFound bool) {
+	rows, err := database.db.Query(fmt.Sprintf("SELECT session_id FROM group_sessions WHERE chat_id=%d", groupChatId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	if rows.Next() {
+		err := rows.Scan(&sessionId)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		isFound = true
+	} else {
+		err = rows.Err()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func (database *SpyBotDb) isGroupSessionUnsafe(sessionId int64) (isGroupSession bool) {
+	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM group_sessions WHERE session_id=%d", sessionId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	isGroupSession = rows.Next()
+
+	return
+}
+
+// GetSessionGroupChat returns the group chat that the public messages of the session go to
+func (database *SpyBotDb) GetSessionGroupChat(sessionId int64) (groupChat GroupChat, isFound bool) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT chat_id, IFNULL(message_id, 0), language FROM group_sessions WHERE session_id=%d", sessionId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	if rows.Next() {
+		err := rows.Scan(&groupChat.ChatId, &groupChat.MessageId, &groupChat.Language)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		isFound = true
+	} else {
+		err = rows.Err()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func (database *SpyBotDb) SetGroupMessageId(sessionId int64, messageId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK group_sessions SET message_id=%d WHERE session_id=%d", messageId, sessionId))
+}
+
+// CreateWebHostedSession creates a session without players, the first player should be added right after
+func (database *SpyBotDb) CreateWebHostedSession() (sessionId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec(fmt.Sprintf("INSERT INTO sessions (token, last_activity, is_web_hosted) VALUES ('%s', strftime('%%s', 'now'), 1)", GenerateToken(sessionTokenBytes)))
+
+	return database.getLastInsertedItemId()
+}
+
+func (database *SpyBotDb) IsSessionWebHosted(sessionId int64) (isWebHosted bool) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	return database.isSessionWebHostedUnsafe(sessionId)
+}
+
+func (database *SpyBotDb) isSessionWebHostedUnsafe(sessionId int64) (isWebHosted bool) {
+	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM sessions WHERE id=%d AND is_web_hosted=1", sessionId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	isWebHosted = rows.Next()
+
+	return
+}
+
 func (database *SpyBotDb) ConnectToSession(userId int64, sessionId int64) (isSucceeded bool, previousSessionId int64, wasInSession bool) {
 	if !database.DoesSessionExist(sessionId) {
 		return
@@ -358,6 +606,38 @@ func (database *SpyBotDb) ConnectToSession(userId int64, sessionId int64) (isSuc
 	defer database.mutex.Unlock()
 
 	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK users SET current_session=%d WHERE id=%d", sessionId, userId))
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK sessions SET last_activity=strftime('%%s', 'now') WHERE id=%d", sessionId))
+
+	isSucceeded = true
+	return
+}
+
+// ConnectToSessionIfNotFull moves the user to the session if it has less than maxPlayers players, the users who are
+// already in the session stay there, the check and the join are done at once so concurrent joins can't exceed the limit
+func (database *SpyBotDb) ConnectToSessionIfNotFull(userId int64, sessionId int64, maxPlayers int64) (isSucceeded bool, isSessionFull bool, previousSessionId int64, wasInSession bool) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	if !database.doesSessionExistUnsafe(sessionId) {
+		return
+	}
+
+	currentSessionId, isInSession := database.getUserSessionUnsafe(userId)
+	if !isInSession || currentSessionId != sessionId {
+		if database.getUsersCountInSessionUnsafe(sessionId, false) >= maxPlayers {
+			isSessionFull = true
+			return
+		}
+
+		if isInSession {
+			database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK users SET current_session=NULL WHERE id=%d", userId))
+			database.removeSessionIfAbandonedUnsafe(currentSessionId)
+			previousSessionId, wasInSession = currentSessionId, true
+		}
+
+		database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK users SET current_session=%d WHERE id=%d", sessionId, userId))
+	}
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK sessions SET last_activity=strftime('%%s', 'now') WHERE id=%d", sessionId))
 
 	isSucceeded = true
 	return
@@ -431,6 +711,39 @@ func (database *SpyBotDb) GetUsersInSession(sessionId int64) (users []int64) {
 	return
 }
 
+type SessionParticipant struct {
+	UserId    int64
+	IsWebUser bool
+}
+
+// GetSessionParticipants returns the players in the order they joined the session
+func (database *SpyBotDb) GetSessionParticipants(sessionId int64) (participants []SessionParticipant) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT users.id, web_users.id IS NOT NULL FROM users LEFT JOIN web_users ON users.id=web_users.user_id WHERE current_session=%d ORDER BY users.id", sessionId))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var participant SessionParticipant
+		err := rows.Scan(&participant.UserId, &participant.IsWebUser)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		participants = append(participants, participant)
+	}
+
+	return
+}
+
 func (database *SpyBotDb) LeaveSession(userId int64) (sessionId int64, wasInSession bool) {
 	sessionId, wasInSession = database.GetUserSession(userId)
 
@@ -443,18 +756,47 @@ func (database *SpyBotDb) LeaveSession(userId int64) (sessionId int64, wasInSess
 
 	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK users SET current_session=NULL WHERE id=%d", userId))
 
-	// delete session if it doesn't have Telegram users in it
-	if database.getUsersCountInSessionUnsafe(sessionId, true) == 0 {
-		database.db.Exec(fmt.Sprintf("DELETE FROM recent_web_messages WHERE user_id in (select user_id from users where current_session=%d)", sessionId))
-		database.db.Exec(fmt.Sprintf("DELETE FROM sessions WHERE id=%d", sessionId))
-		database.db.Exec(fmt.Sprintf("DELETE FROM web_users WHERE user_id IN (SELECT id FROM users WHERE current_session=%d)", sessionId))
-		// the remaining users that have this session is the web users that we just deleted
-		database.db.Exec(fmt.Sprintf("DELETE FROM users WHERE current_session=%d", sessionId))
-	}
+	database.removeSessionIfAbandonedUnsafe(sessionId)
 
 	return
 }
 
+// removeSessionIfAbandonedUnsafe deletes a session that has no Telegram users in it,
+// web hosted sessions are deleted only when they have no players at all,
+// the sessions of group chats stay until a new game is started in the group or they expire
+func (database *SpyBotDb) removeSessionIfAbandonedUnsafe(sessionId int64) {
+	if database.getUsersCountInSessionUnsafe(sessionId, true) > 0 {
+		return
+	}
+
+	if database.isGroupSessionUnsafe(sessionId) {
+		return
+	}
+
+	if database.isSessionWebHostedUnsafe(sessionId) && database.getUsersCountInSessionUnsafe(sessionId, false) > 0 {
+		return
+	}
+
+	database.removeSessionUnsafe(sessionId)
+}
+
+// RemoveSession deletes the session together with its web users, Telegram users stay but lose the session
+func (database *SpyBotDb) RemoveSession(sessionId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.removeSessionUnsafe(sessionId)
+}
+
+func (database *SpyBotDb) removeSessionUnsafe(sessionId int64) {
+	database.db.Exec(fmt.Sprintf("DELETE FROM recent_web_messages WHERE user_id IN (SELECT web_users.user_id FROM web_users JOIN users ON users.id=web_users.user_id WHERE current_session=%d)", sessionId))
+	database.db.Exec(fmt.Sprintf("DELETE FROM users WHERE current_session=%d AND id IN (SELECT user_id FROM web_users)", sessionId))
+	database.db.Exec("DELETE FROM web_users WHERE user_id NOT IN (SELECT id FROM users)")
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK users SET current_session=NULL WHERE current_session=%d", sessionId))
+	database.db.Exec(fmt.Sprintf("DELETE FROM group_sessions WHERE session_id=%d", sessionId))
+	database.db.Exec(fmt.Sprintf("DELETE FROM sessions WHERE id=%d", sessionId))
+}
+
 func (database *SpyBotDb) SetSessionMessageId(userId int64, messageId int64) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
@@ -557,11 +899,30 @@ func (database *SpyBotDb) GetTokenFromSessionId(sessionId int64) (token string,
 	return
 }
 
-func (database *SpyBotDb) AddWebUser(sessionId int64, token int64) (wasAdded bool) {
+func (database *SpyBotDb) AddWebUser(sessionId int64, token string) (wasAdded bool) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	return database.addWebUserUnsafe(sessionId, token)
+}
+
+// AddWebUserIfNotFull adds the player only if the session has less than maxPlayers players,
+// the check and the insert are done at once so concurrent joins can't exceed the limit
+func (database *SpyBotDb) AddWebUserIfNotFull(sessionId int64, token string, maxPlayers int64) (wasAdded bool, isSessionFull bool) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM web_users WHERE token=%d", token))
+	if database.getUsersCountInSessionUnsafe(sessionId, false) >= maxPlayers {
+		return false, true
+	}
+
+	return database.addWebUserUnsafe(sessionId, token), false
+}
+
+func (database *SpyBotDb) addWebUserUnsafe(sessionId int64, token string) (wasAdded bool) {
+	tokenHash := hashWebUserToken(token)
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM web_users WHERE token='%s'", tokenHash))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -585,16 +946,18 @@ func (database *SpyBotDb) AddWebUser(sessionId int64, token int64) (wasAdded boo
 
 	userId := database.getLastInsertedItemId()
 
-	database.db.Exec(fmt.Sprintf("INSERT INTO web_users (user_id, token) VALUES (%d, %d)", userId, token))
+	database.db.Exec(fmt.Sprintf("INSERT INTO web_users (user_id, token, last_activity) VALUES (%d, '%s', strftime('%%s', 'now'))", userId, tokenHash))
 
 	return true
 }
 
-func (database *SpyBotDb) RemoveWebUser(token int64) {
+func (database *SpyBotDb) RemoveWebUser(token string) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id FROM web_users WHERE token=%d", token))
+	tokenHash := hashWebUserToken(token)
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id, IFNULL(current_session, 0) FROM web_users JOIN users ON users.id=web_users.user_id WHERE token='%s'", tokenHash))
 	if err != nil {
 		log.Fatal(err.Error())
 		return
@@ -607,8 +970,9 @@ func (database *SpyBotDb) RemoveWebUser(token int64) {
 	}()
 
 	var userId int64
+	var sessionId int64
 	if rows.Next() {
-		err := rows.Scan(&userId)
+		err := rows.Scan(&userId, &sessionId)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
@@ -622,16 +986,20 @@ func (database *SpyBotDb) RemoveWebUser(token int64) {
 		return
 	}
 
-	database.db.Exec(fmt.Sprintf("DELETE FROM web_users WHERE token=%d", token))
+	database.db.Exec(fmt.Sprintf("DELETE FROM web_users WHERE token='%s'", tokenHash))
 	database.db.Exec(fmt.Sprintf("DELETE FROM users WHERE id=%d", userId))
 	database.db.Exec(fmt.Sprintf("DELETE FROM recent_web_messages WHERE user_id=%d", userId))
+
+	if sessionId != 0 {
+		database.removeSessionIfAbandonedUnsafe(sessionId)
+	}
 }
 
-func (database *SpyBotDb) DoesWebUserExist(token int64) (isExists bool) {
+func (database *SpyBotDb) DoesWebUserExist(token string) (isExists bool) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM web_users WHERE token=%d", token))
+	rows, err := database.db.Query(fmt.Sprintf("SELECT 1 FROM web_users WHERE token='%s'", hashWebUserToken(token)))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -647,11 +1015,11 @@ func (database *SpyBotDb) DoesWebUserExist(token int64) (isExists bool) {
 	return
 }
 
-func (database *SpyBotDb) GetWebUserId(token int64) (userId int64, isFound bool) {
+func (database *SpyBotDb) GetWebUserId(token string) (userId int64, isFound bool) {
 	database.mutex.Lock()
 	defer database.mutex.Unlock()
 
-	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id FROM web_users WHERE token=%d", token))
+	rows, err := database.db.Query(fmt.Sprintf("SELECT user_id FROM web_users WHERE token='%s'", hashWebUserToken(token)))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -714,3 +1082,102 @@ func (database *SpyBotDb) GetNewRecentWebMessages(userId int64, lastIndex int) (
 
 	return
 }
+
+// MarkUserActive refreshes the activity time of the user's session and of the user itself if it is a web user
+func (database *SpyBotDb) MarkUserActive(userId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK sessions SET last_activity=strftime('%%s', 'now') WHERE id=(SELECT current_session FROM users WHERE id=%d)", userId))
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK web_users SET last_activity=strftime('%%s', 'now') WHERE user_id=%d", userId))
+}
+
+// UpdateWebUserActivity refreshes only the web user, so an open web page doesn't keep the session alive
+func (database *SpyBotDb) UpdateWebUserActivity(userId int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec(fmt.Sprintf("UPDATE OR ROLLBACK web_users SET last_activity=strftime('%%s', 'now') WHERE user_id=%d", userId))
+}
+
+func (database *SpyBotDb) GetSessionsIdleSince(timestamp int64) (sessions []int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT id FROM sessions WHERE last_activity<%d", timestamp))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var sessionId int64
+		err := rows.Scan(&sessionId)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		sessions = append(sessions, sessionId)
+	}
+
+	return
+}
+
+// RemoveWebUsersIdleSince removes web users that were not active after the timestamp
+// and returns the sessions they were in
+func (database *SpyBotDb) RemoveWebUsersIdleSince(timestamp int64) (sessions []int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	rows, err := database.db.Query(fmt.Sprintf("SELECT DISTINCT current_session FROM users JOIN web_users ON users.id=web_users.user_id WHERE last_activity<%d AND current_session IS NOT NULL", timestamp))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var sessionId int64
+		err := rows.Scan(&sessionId)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		sessions = append(sessions, sessionId)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	database.db.Exec(fmt.Sprintf("DELETE FROM recent_web_messages WHERE user_id IN (SELECT user_id FROM web_users WHERE last_activity<%d)", timestamp))
+	database.db.Exec(fmt.Sprintf("DELETE FROM users WHERE id IN (SELECT user_id FROM web_users WHERE last_activity<%d)", timestamp))
+	database.db.Exec(fmt.Sprintf("DELETE FROM web_users WHERE last_activity<%d", timestamp))
+
+	return
+}
+
+// RemoveOrphanedRecords deletes rows that are not reachable anymore after sessions or users were removed
+func (database *SpyBotDb) RemoveOrphanedRecords() {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.db.Exec("DELETE FROM web_users WHERE user_id NOT IN (SELECT id FROM users)")
+	database.db.Exec("DELETE FROM users WHERE id NOT IN (SELECT user_id FROM telegram_users) AND id NOT IN (SELECT user_id FROM web_users)")
+	database.db.Exec("DELETE FROM recent_web_messages WHERE user_id NOT IN (SELECT user_id FROM web_users)")
+	database.db.Exec("UPDATE OR ROLLBACK users SET current_session=NULL WHERE current_session IS NOT NULL AND current_session NOT IN (SELECT id FROM sessions)")
+	database.db.Exec("DELETE FROM sessions WHERE is_web_hosted=1 AND id NOT IN (SELECT current_session FROM users WHERE current_session IS NOT NULL)")
+	database.db.Exec("DELETE FROM group_sessions WHERE session_id NOT IN (SELECT id FROM sessions)")
+	// web users can't exist outside of a session
+	database.db.Exec("DELETE FROM users WHERE current_session IS NULL AND id IN (SELECT user_id FROM web_users)")
+	database.db.Exec("DELETE FROM web_users WHERE user_id NOT IN (SELECT id FROM users)")
+	database.db.Exec("DELETE FROM recent_web_messages WHERE user_id NOT IN (SELECT user_id FROM web_users)")
+}
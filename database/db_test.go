@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"os"
 	"testing"
+	"time"
 )
 
 const (
@@ -125,6 +126,9 @@ func TestGetUserId(t *testing.T) {
 	var chatId1 int64 = 321
 	var chatId2 int64 = 123
 
+	_, found := db.FindTelegramUserId(chatId1)
+	assert.False(found)
+
 	id1 := db.GetOrCreateTelegramUserId(chatId1, "")
 	id2 := db.GetOrCreateTelegramUserId(chatId1, "")
 	id3 := db.GetOrCreateTelegramUserId(chatId2, "")
@@ -132,6 +136,10 @@ func TestGetUserId(t *testing.T) {
 	assert.Equal(id1, id2)
 	assert.NotEqual(id1, id3)
 
+	foundId, found := db.FindTelegramUserId(chatId1)
+	assert.True(found)
+	assert.Equal(id1, foundId)
+
 	userChatId1, found := db.GetTelegramUserChatId(id1)
 	assert.True(found)
 	assert.Equal(chatId1, userChatId1)
@@ -171,6 +179,100 @@ func TestUserLanguage(t *testing.T) {
 	}
 }
 
+func TestWebUserLanguage(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	// the web user takes a user id that doesn't match the id of the next Telegram user record
+	telegramUserId := db.GetOrCreateTelegramUserId(123, "en-US")
+	sessionId, _, _ := db.CreateSession(telegramUserId)
+	db.AddWebUser(sessionId, "token10")
+	webUserId, _ := db.GetWebUserId("token10")
+	secondTelegramUserId := db.GetOrCreateTelegramUserId(321, "en-US")
+
+	assert.Equal("", db.GetUserLanguage(webUserId))
+
+	db.SetUserLanguage(webUserId, "ru-RU")
+	db.SetUserLanguage(secondTelegramUserId, "de-DE")
+
+	assert.Equal("ru-RU", db.GetUserLanguage(webUserId))
+	assert.Equal("en-US", db.GetUserLanguage(telegramUserId))
+	assert.Equal("de-DE", db.GetUserLanguage(secondTelegramUserId))
+
+	// the same user is found again
+	assert.Equal(secondTelegramUserId, db.GetOrCreateTelegramUserId(321, ""))
+	assert.NotEqual(webUserId, db.GetOrCreateTelegramUserId(123, ""))
+}
+
+func TestTelegramUserIdAfterWebPlayers(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	// the web player takes the users record, so the next telegram_users record gets another id
+	sessionId := db.CreateWebHostedSession()
+	db.AddWebUser(sessionId, "token10")
+
+	userId1 := db.GetOrCreateTelegramUserId(123, "en-us")
+	userId2 := db.GetOrCreateTelegramUserId(321, "en-us")
+	// the found user has the same id as the created one
+	assert.Equal(userId1, db.GetOrCreateTelegramUserId(123, ""))
+	assert.Equal(userId2, db.GetOrCreateTelegramUserId(321, ""))
+
+	db.SetUserLanguage(userId1, "ru-ru")
+	assert.Equal("ru-ru", db.GetUserLanguage(userId1))
+	assert.Equal("en-us", db.GetUserLanguage(userId2))
+}
+
+func TestUserLanguageFixUp(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	// the state of version 0.5: a web player took users record 1, so the telegram_users ids are one less than the user ids,
+	// and the language chosen by the user 3 was written to the record with id 3 that belongs to the user 4
+	db.db.Exec("INSERT INTO users DEFAULT VALUES")
+	db.db.Exec("INSERT INTO users DEFAULT VALUES")
+	db.db.Exec("INSERT INTO users DEFAULT VALUES")
+	db.db.Exec("INSERT INTO users DEFAULT VALUES")
+	db.db.Exec("INSERT INTO telegram_users (id, user_id, chat_id, language) VALUES (1, 2, 20, 'ru-ru')")
+	db.db.Exec("INSERT INTO telegram_users (id, user_id, chat_id, language) VALUES (2, 3, 30, 'en')")
+	db.db.Exec("INSERT INTO telegram_users (id, user_id, chat_id, language) VALUES (3, 4, 40, 'ru-ru')")
+	db.SetDatabaseVersion("0.5")
+
+	UpdateVersion(db)
+
+	assert.Equal(latestVersion, db.GetDatabaseVersion())
+	// the records that could have got the language of another user
+	assert.Equal("", db.GetUserLanguage(3))
+	assert.Equal("", db.GetUserLanguage(4))
+	// nobody could write to the record with the id of the web player
+	assert.Equal("ru-ru", db.GetUserLanguage(2))
+
+	// the user gets the language of the Telegram client back and keeps the chosen one later
+	assert.Equal(int64(4), db.GetOrCreateTelegramUserId(40, "de"))
+	assert.Equal("de", db.GetUserLanguage(4))
+	db.SetUserLanguage(4, "ru-ru")
+	db.GetOrCreateTelegramUserId(40, "de")
+	assert.Equal("ru-ru", db.GetUserLanguage(4))
+}
+
 func TestUserSession(t *testing.T) {
 	assert := require.New(t)
 	db := createDbAndConnect(t)
@@ -286,7 +388,7 @@ func TestAddWebUser(t *testing.T) {
 	}
 	defer db.Disconnect()
 
-	webUserToken := int64(10)
+	webUserToken := "token10"
 
 	// we can add web users only if we have a session
 	userId := db.GetOrCreateTelegramUserId(123, "")
@@ -333,6 +435,52 @@ func TestAddWebUser(t *testing.T) {
 	assert.False(isFound)
 }
 
+func TestJoinSessionIfNotFull(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	hostId := db.GetOrCreateTelegramUserId(123, "")
+	sessionId, _, _ := db.CreateSession(hostId)
+
+	wasAdded, isSessionFull := db.AddWebUserIfNotFull(sessionId, "token10", 3)
+	assert.True(wasAdded)
+	assert.False(isSessionFull)
+
+	userId := db.GetOrCreateTelegramUserId(124, "")
+	previousSessionId, _, _ := db.CreateSession(userId)
+	isSucceeded, isSessionFull, leftSessionId, wasInSession := db.ConnectToSessionIfNotFull(userId, sessionId, 3)
+	assert.True(isSucceeded)
+	assert.False(isSessionFull)
+	assert.True(wasInSession)
+	assert.Equal(previousSessionId, leftSessionId)
+	assert.False(db.DoesSessionExist(previousSessionId))
+
+	wasAdded, isSessionFull = db.AddWebUserIfNotFull(sessionId, "token20", 3)
+	assert.False(wasAdded)
+	assert.True(isSessionFull)
+	assert.False(db.DoesWebUserExist("token20"))
+
+	lateUserId := db.GetOrCreateTelegramUserId(125, "")
+	isSucceeded, isSessionFull, _, _ = db.ConnectToSessionIfNotFull(lateUserId, sessionId, 3)
+	assert.False(isSucceeded)
+	assert.True(isSessionFull)
+	_, isInSession := db.GetUserSession(lateUserId)
+	assert.False(isInSession)
+
+	// the players who are already in the full session can join it again
+	isSucceeded, isSessionFull, _, wasInSession = db.ConnectToSessionIfNotFull(userId, sessionId, 3)
+	assert.True(isSucceeded)
+	assert.False(isSessionFull)
+	assert.False(wasInSession)
+	assert.Equal(int64(3), db.GetUsersCountInSession(sessionId, false))
+}
+
 func TestRemoveWebUser(t *testing.T) {
 	assert := require.New(t)
 	db := createDbAndConnect(t)
@@ -343,7 +491,7 @@ func TestRemoveWebUser(t *testing.T) {
 	}
 	defer db.Disconnect()
 
-	webUserToken := int64(10)
+	webUserToken := "token10"
 
 	userId := db.GetOrCreateTelegramUserId(123, "")
 	sessionId, _, _ := db.CreateSession(userId)
@@ -359,6 +507,162 @@ func TestRemoveWebUser(t *testing.T) {
 	assert.Equal(int64(1), db.GetUsersCountInSession(sessionId, false))
 }
 
+func TestTokens(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	userId := db.GetOrCreateTelegramUserId(123, "")
+	sessionId, _, _ := db.CreateSession(userId)
+	secondSessionId := db.CreateWebHostedSession()
+
+	sessionToken, _ := db.GetTokenFromSessionId(sessionId)
+	secondSessionToken, _ := db.GetTokenFromSessionId(secondSessionId)
+	assert.Len(sessionToken, 22)
+	assert.NotEqual(sessionToken, secondSessionToken)
+
+	// only the hash of the player token gets to the database
+	db.AddWebUser(sessionId, "token10")
+	rows, err := db.db.Query("SELECT token FROM web_users")
+	assert.NoError(err)
+	assert.True(rows.Next())
+	var storedToken string
+	assert.NoError(rows.Scan(&storedToken))
+	assert.NoError(rows.Close())
+	assert.NotContains(storedToken, "token10")
+	assert.True(db.DoesWebUserExist("token10"))
+}
+
+func TestUpdateWebUserTokens(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	// the state of version 0.4 with a numeric token
+	db.db.Exec("DROP TABLE web_users")
+	db.db.Exec("CREATE TABLE web_users(id INTEGER NOT NULL PRIMARY KEY, user_id INTEGER UNIQUE NOT NULL, token INTEGER UNIQUE NOT NULL, last_activity INTEGER NOT NULL DEFAULT 0, language TEXT)")
+	db.db.Exec("INSERT INTO sessions (token, last_activity) VALUES ('1700000000-42', strftime('%s', 'now'))")
+	db.db.Exec("INSERT INTO users (current_session) VALUES (1)")
+	db.db.Exec("INSERT INTO web_users (user_id, token, last_activity) VALUES (1, 1234567, strftime('%s', 'now'))")
+	db.SetDatabaseVersion("0.4")
+
+	UpdateVersion(db)
+
+	assert.Equal(latestVersion, db.GetDatabaseVersion())
+	userId, isFound := db.GetWebUserId("1234567")
+	assert.True(isFound)
+	assert.Equal(int64(1), userId)
+
+	_, isFound = db.GetSessionIdFromToken("1700000000-42")
+	assert.False(isFound)
+	sessionToken, _ := db.GetTokenFromSessionId(1)
+	assert.Len(sessionToken, 22)
+}
+
+func TestWebHostedSession(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	sessionId := db.CreateWebHostedSession()
+	assert.True(db.IsSessionWebHosted(sessionId))
+	assert.True(db.AddWebUser(sessionId, "token10"))
+	assert.True(db.AddWebUser(sessionId, "token20"))
+
+	telegramUserId := db.GetOrCreateTelegramUserId(123, "")
+	db.ConnectToSession(telegramUserId, sessionId)
+
+	participants := db.GetSessionParticipants(sessionId)
+	assert.Len(participants, 3)
+	assert.True(participants[0].IsWebUser)
+	assert.True(participants[1].IsWebUser)
+	assert.False(participants[2].IsWebUser)
+	assert.Equal(telegramUserId, participants[2].UserId)
+
+	// the session doesn't need Telegram users to survive
+	db.LeaveSession(telegramUserId)
+	assert.True(db.DoesSessionExist(sessionId))
+
+	db.RemoveWebUser("token10")
+	assert.True(db.DoesSessionExist(sessionId))
+
+	db.RemoveWebUser("token20")
+	assert.False(db.DoesSessionExist(sessionId))
+
+	// the sessions created from Telegram are not web hosted
+	sessionId, _, _ = db.CreateSession(telegramUserId)
+	assert.False(db.IsSessionWebHosted(sessionId))
+}
+
+func TestGroupSession(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	const groupChatId = int64(-1001)
+
+	sessionId := db.CreateGroupSession(groupChatId, "ru-ru")
+	groupChat, isFound := db.GetSessionGroupChat(sessionId)
+	assert.True(isFound)
+	assert.Equal(groupChatId, groupChat.ChatId)
+	assert.Equal(int64(0), groupChat.MessageId)
+	assert.Equal("ru-ru", groupChat.Language)
+
+	db.SetGroupMessageId(sessionId, 15)
+	groupChat, _ = db.GetSessionGroupChat(sessionId)
+	assert.Equal(int64(15), groupChat.MessageId)
+
+	// a new game in the group removes the previous one if nobody joined it
+	token, _ := db.GetTokenFromSessionId(sessionId)
+	newSessionId := db.CreateGroupSession(groupChatId, "en-us")
+	_, isFound = db.GetSessionIdFromToken(token)
+	assert.False(isFound)
+	groupChat, _ = db.GetSessionGroupChat(newSessionId)
+	assert.Equal("en-us", groupChat.Language)
+
+	// the game stays in the group when everyone left
+	userId := db.GetOrCreateTelegramUserId(123, "")
+	db.ConnectToSession(userId, newSessionId)
+	db.LeaveSession(userId)
+	assert.True(db.DoesSessionExist(newSessionId))
+
+	// the players of the previous game can go on without the group
+	db.ConnectToSession(userId, newSessionId)
+	lastSessionId := db.CreateGroupSession(groupChatId, "en-us")
+	assert.True(db.DoesSessionExist(newSessionId))
+	_, isFound = db.GetSessionGroupChat(newSessionId)
+	assert.False(isFound)
+
+	db.RemoveSession(lastSessionId)
+	_, isFound = db.GetSessionGroupChat(lastSessionId)
+	assert.False(isFound)
+
+	// private sessions have no group
+	sessionId, _, _ = db.CreateSession(userId)
+	_, isFound = db.GetSessionGroupChat(sessionId)
+	assert.False(isFound)
+}
+
 func TestWebMessages(t *testing.T) {
 	assert := require.New(t)
 	db := createDbAndConnect(t)
@@ -372,7 +676,7 @@ func TestWebMessages(t *testing.T) {
 	userId := db.GetOrCreateTelegramUserId(123, "")
 	sessionId, _, _ := db.CreateSession(userId)
 
-	webUserToken := int64(42)
+	webUserToken := "token42"
 	db.AddWebUser(sessionId, webUserToken)
 	webUserId, _ := db.GetWebUserId(webUserToken)
 
@@ -451,7 +755,7 @@ func TestWebMessagesClearing(t *testing.T) {
 	{
 		sessionId, _, _ := db.CreateSession(userId)
 
-		webUserToken := int64(42)
+		webUserToken := "token42"
 		db.AddWebUser(sessionId, webUserToken)
 		webUserId, _ := db.GetWebUserId(webUserToken)
 
@@ -463,7 +767,7 @@ func TestWebMessagesClearing(t *testing.T) {
 	{
 		sessionId, _, _ := db.CreateSession(userId)
 
-		webUserToken := int64(63)
+		webUserToken := "token63"
 		db.AddWebUser(sessionId, webUserToken)
 		webUserId, _ := db.GetWebUserId(webUserToken)
 
@@ -472,3 +776,176 @@ func TestWebMessagesClearing(t *testing.T) {
 		assert.Equal(-1, newLastIndex)
 	}
 }
+
+func TestIdleSessionsCleanup(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	userId := db.GetOrCreateTelegramUserId(123, "")
+	sessionId, _, _ := db.CreateSession(userId)
+
+	webUserToken := "token42"
+	db.AddWebUser(sessionId, webUserToken)
+	webUserId, _ := db.GetWebUserId(webUserToken)
+	db.AddWebMessage(webUserId, "command1", 10)
+
+	past := time.Now().Add(-time.Hour).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+
+	assert.Equal(0, len(db.GetSessionsIdleSince(past)))
+	assert.Equal(0, len(db.RemoveWebUsersIdleSince(past)))
+	assert.True(db.DoesWebUserExist(webUserToken))
+
+	{
+		sessions := db.GetSessionsIdleSince(future)
+		assert.Equal(1, len(sessions))
+		assert.Equal(sessionId, sessions[0])
+	}
+
+	{
+		sessions := db.RemoveWebUsersIdleSince(future)
+		assert.Equal(1, len(sessions))
+		assert.Equal(sessionId, sessions[0])
+		assert.False(db.DoesWebUserExist(webUserToken))
+		assert.Equal(int64(1), db.GetUsersCountInSession(sessionId, false))
+		messages, _ := db.GetNewRecentWebMessages(webUserId, -1)
+		assert.Equal(0, len(messages))
+	}
+
+	db.AddWebUser(sessionId, webUserToken)
+	db.RemoveSession(sessionId)
+
+	assert.False(db.DoesSessionExist(sessionId))
+	assert.False(db.DoesWebUserExist(webUserToken))
+	_, isInSession := db.GetUserSession(userId)
+	assert.False(isInSession)
+	// Telegram users are kept
+	_, isFound := db.GetTelegramUserChatId(userId)
+	assert.True(isFound)
+
+	db.RemoveOrphanedRecords()
+	_, isFound = db.GetTelegramUserChatId(userId)
+	assert.True(isFound)
+}
+
+func TestBackup(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	const backupPath = "./testBackup.db"
+	dropDatabase(backupPath)
+	defer dropDatabase(backupPath)
+
+	userId := db.GetOrCreateTelegramUserId(123, "")
+	db.SetUserLanguage(userId, "ru-ru")
+
+	assert.Nil(db.Backup(backupPath))
+	// existing files are not overwritten
+	assert.NotNil(db.Backup(backupPath))
+
+	backupDb, err := ConnectDb(backupPath)
+	assert.Nil(err)
+	defer backupDb.Disconnect()
+
+	assert.Equal(userId, backupDb.GetOrCreateTelegramUserId(123, ""))
+	assert.Equal("ru-ru", backupDb.GetUserLanguage(userId))
+}
+
+func TestExportImport(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+
+	userId1 := db.GetOrCreateTelegramUserId(123, "en-us")
+	userId2 := db.GetOrCreateTelegramUserId(321, "")
+	db.SetUserLanguage(userId2, "ru-ru")
+	db.CreateSession(userId1)
+
+	data := db.ExportData()
+	assert.Equal(latestVersion, data.Version)
+	assert.Equal(2, len(data.TelegramUsers))
+
+	db.Disconnect()
+
+	db = createDbAndConnect(t)
+	defer db.Disconnect()
+
+	assert.Equal(2, db.ImportData(data))
+
+	assert.Equal("en-us", db.GetUserLanguage(db.GetOrCreateTelegramUserId(123, "")))
+	assert.Equal("ru-ru", db.GetUserLanguage(db.GetOrCreateTelegramUserId(321, "")))
+	_, isInSession := db.GetUserSession(db.GetOrCreateTelegramUserId(123, ""))
+	assert.False(isInSession)
+
+	// the values are escaped only once
+	db.ImportData(ExportedData{TelegramUsers: []ExportedTelegramUser{{ChatId: 456, Language: "it's"}}})
+	assert.Equal("it's", db.GetUserLanguage(db.GetOrCreateTelegramUserId(456, "")))
+}
+
+func TestAdminQueries(t *testing.T) {
+	assert := require.New(t)
+	db := createDbAndConnect(t)
+	defer clearDb()
+	if db == nil {
+		t.Fail()
+		return
+	}
+	defer db.Disconnect()
+
+	userId1 := db.GetOrCreateTelegramUserId(123, "ru-ru")
+	userId2 := db.GetOrCreateTelegramUserId(321, "")
+	sessionId, _, _ := db.CreateSession(userId1)
+	db.ConnectToSession(userId2, sessionId)
+	db.AddWebUser(sessionId, "token42")
+	webUserId, _ := db.GetWebUserId("token42")
+	groupSessionId := db.CreateGroupSession(-100, "en-us")
+
+	sessions := db.GetActiveSessions(10)
+	assert.Len(sessions, 2)
+	for _, session := range sessions {
+		if session.Id == sessionId {
+			assert.Equal(int64(3), session.PlayersCount)
+			assert.False(session.IsGroup)
+		} else {
+			assert.Equal(groupSessionId, session.Id)
+			assert.Equal(int64(0), session.PlayersCount)
+			assert.True(session.IsGroup)
+		}
+	}
+	assert.Len(db.GetActiveSessions(1), 1)
+
+	assert.Equal([]BroadcastRecipient{
+		{UserId: userId1, ChatId: 123, Language: "ru-ru"},
+		{UserId: userId2, ChatId: 321, Language: ""},
+		{UserId: webUserId, ChatId: 0, Language: ""},
+	}, db.GetBroadcastRecipients())
+
+	assert.Equal(BotStats{Sessions: 2, TelegramUsers: 2, WebUsers: 1, Players: 3}, db.GetStats())
+
+	assert.Empty(db.GetRecentAdminAuditRecords(10))
+	db.AddAdminAuditRecord(123, "backup", "")
+	db.AddAdminAuditRecord(123, "broadcast", "the bot will be 'restarted'")
+	records := db.GetRecentAdminAuditRecords(10)
+	assert.Len(records, 2)
+	assert.Equal("broadcast", records[0].Action)
+	assert.Equal("the bot will be 'restarted'", records[0].Details)
+	assert.Equal(int64(123), records[0].AdminChatId)
+	assert.NotZero(records[0].Time)
+	assert.Equal("backup", records[1].Action)
+}
@@ -3,11 +3,13 @@ package database
 import (
 	"fmt"
 	"log"
+	"math"
+	"strconv"
 )
 
 const (
 	minimalVersion = "0.1"
-	latestVersion  = "0.2"
+	latestVersion  = "0.6"
 )
 
 type dbUpdater struct {
@@ -111,5 +113,84 @@ func makeAllUpdaters() []dbUpdater {
 				db.db.Exec("DROP TABLE users_old")
 			},
 		},
+		{
+			version: "0.3",
+			updateDb: func(db *SpyBotDb) {
+				// track activity to be able to clean up abandoned sessions
+				db.db.Exec("ALTER TABLE sessions ADD COLUMN last_activity INTEGER NOT NULL DEFAULT 0")
+				db.db.Exec("ALTER TABLE web_users ADD COLUMN last_activity INTEGER NOT NULL DEFAULT 0")
+				db.db.Exec("UPDATE sessions SET last_activity=strftime('%s', 'now')")
+				db.db.Exec("UPDATE web_users SET last_activity=strftime('%s', 'now')")
+			},
+		},
+		{
+			version: "0.4",
+			updateDb: func(db *SpyBotDb) {
+				// sessions can be created from the web client and web players can choose their language
+				db.db.Exec("ALTER TABLE sessions ADD COLUMN is_web_hosted INTEGER NOT NULL DEFAULT 0")
+				db.db.Exec("ALTER TABLE web_users ADD COLUMN language TEXT")
+			},
+		},
+		{
+			version: "0.5",
+			updateDb: func(db *SpyBotDb) {
+				// the old tokens were made from the creation time, the already shared invite links stop working
+				sessionIds := db.GetSessionsIdleSince(math.MaxInt64)
+				for _, sessionId := range sessionIds {
+					db.db.Exec(fmt.Sprintf("UPDATE sessions SET token='%s' WHERE id=%d", GenerateToken(sessionTokenBytes), sessionId))
+				}
+
+				// store only the hashes of the web player tokens, the old numeric tokens keep working
+				rows, err := db.db.Query("SELECT id, token FROM web_users")
+				if err != nil {
+					log.Fatalf("Error while selecting web users: %s", err)
+				}
+				defer func() {
+					err := rows.Close()
+					if err != nil {
+						log.Fatalf("Error while closing rows: %s", err)
+					}
+				}()
+
+				tokenHashes := make(map[int64]string)
+				for rows.Next() {
+					var id int64
+					var token int64
+					err := rows.Scan(&id, &token)
+					if err != nil {
+						log.Fatalf("Error while scanning web user: %s", err)
+					}
+					tokenHashes[id] = hashWebUserToken(strconv.FormatInt(token, 10))
+				}
+
+				err = rows.Close()
+				if err != nil {
+					log.Fatalf("Error while closing rows: %s", err)
+				}
+
+				db.db.Exec("ALTER TABLE web_users RENAME TO web_users_old")
+				db.db.Exec("CREATE TABLE" +
+					" web_users(id INTEGER NOT NULL PRIMARY KEY" +
+					",user_id INTEGER UNIQUE NOT NULL" +
+					",token TEXT UNIQUE NOT NULL" +
+					",last_activity INTEGER NOT NULL DEFAULT 0" +
+					",language TEXT" +
+					")")
+				db.db.Exec("INSERT INTO web_users (id, user_id, token, last_activity, language) SELECT id, user_id, CAST(token AS TEXT), last_activity, language FROM web_users_old")
+				db.db.Exec("DROP TABLE web_users_old")
+				for id, tokenHash := range tokenHashes {
+					db.db.Exec(fmt.Sprintf("UPDATE web_users SET token='%s' WHERE id=%d", tokenHash, id))
+				}
+			},
+		},
+		{
+			version: "0.6",
+			updateDb: func(db *SpyBotDb) {
+				// the language was set by telegram_users.id while a new user got users.id, after the web players took
+				// some users records the ids differ and the choice of a new user could be written to the record of another user,
+				// these records can't be told apart, so they get the language of the Telegram client on the next message
+				db.db.Exec("UPDATE telegram_users SET language='' WHERE id IN (SELECT user_id FROM telegram_users WHERE user_id!=id)")
+			},
+		},
 	}
 }
@@ -0,0 +1,90 @@
+package dialogFactories
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
+	"github.com/gameraccoon/telegram-bot-skeleton/dialogFactory"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"log"
+	"strconv"
+)
+
+type groupVariantPrototype struct {
+	id         string
+	textId     string
+	process    func(int64, *processing.ProcessData) bool
+	rowId      int
+	isActiveFn func() bool
+}
+
+// groupDialogFactory makes the message in a group chat that the players join the game with,
+// customData is the id of the session
+type groupDialogFactory struct {
+	variants []groupVariantPrototype
+}
+
+func MakeGroupDialogFactory() dialogFactory.DialogFactory {
+	return &(groupDialogFactory{
+		variants: []groupVariantPrototype{
+			groupVariantPrototype{
+				id:      "join",
+				textId:  "group_join",
+				process: joinGroupGame,
+				rowId:   1,
+			},
+		},
+	})
+}
+
+func joinGroupGame(sessionId int64, data *processing.ProcessData) bool {
+	// the button can't be replaced with a typed command, otherwise anyone could join any group game by its number
+	if data.AnsweredMessageId == 0 {
+		return false
+	}
+	staticFunctions.JoinGroupSession(data, sessionId)
+	return true
+}
+
+func (factory *groupDialogFactory) createVariants(trans i18n.TranslateFunc, sessionId int64) (variants []dialog.Variant) {
+	variants = make([]dialog.Variant, 0)
+
+	for _, variant := range factory.variants {
+		if variant.isActiveFn == nil || variant.isActiveFn() {
+			variants = append(variants, dialog.Variant{
+				Id:           variant.id,
+				Text:         trans(variant.textId),
+				RowId:        variant.rowId,
+				AdditionalId: strconv.FormatInt(sessionId, 10),
+			})
+		}
+	}
+	return
+}
+
+func (factory *groupDialogFactory) MakeDialog(userId int64, trans i18n.TranslateFunc, staticData *processing.StaticProccessStructs, customData interface{}) *dialog.Dialog {
+	sessionId, isSessionId := customData.(int64)
+	if !isSessionId {
+		log.Printf("Group dialog is made without a session")
+		return nil
+	}
+
+	translationMap := map[string]interface{}{
+		"Participants": staticFunctions.GetDb(staticData).GetUsersCountInSession(sessionId, false),
+	}
+
+	return &dialog.Dialog{
+		Text:     trans("group_game_title", translationMap),
+		Variants: factory.createVariants(trans, sessionId),
+	}
+}
+
+func (factory *groupDialogFactory) ProcessVariant(variantId string, additionalId string, data *processing.ProcessData) bool {
+	sessionId, _ := strconv.ParseInt(additionalId, 10, 64)
+	for _, variant := range factory.variants {
+		if variant.id == variantId {
+			return variant.process(sessionId, data)
+		}
+	}
+	return false
+}
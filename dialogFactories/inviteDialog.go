@@ -1,11 +1,9 @@
 package dialogFactories
 
 import (
-	"fmt"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialogFactory"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
 	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
 	"github.com/nicksnyder/go-i18n/i18n"
 	"log"
@@ -68,29 +66,24 @@ func shareLink(sessionId int64, gameType string, data *processing.ProcessData) b
 		log.Printf("Can't find session token for sessionId %d", sessionId)
 	}
 
-	config, configCastSuccess := staticData.Config.(static.StaticConfiguration)
+	config, _ := staticFunctions.GetConfig(staticData)
 
-	if !configCastSuccess {
-		config = static.StaticConfiguration{}
-	}
+	data.SendMessage(data.Trans("invite_share_text"), true)
+
+	data.SendMessage(data.Trans("invite_link", map[string]interface{}{
+		"Link": staticFunctions.GetInviteLink(&config, gameType, sessionToken),
+	}), true)
+
+	data.SendMessage(data.Trans("invite_telegram_link", map[string]interface{}{
+		"Link": staticFunctions.GetTelegramInviteLink(staticData.BotName, gameType, sessionToken),
+	}), true)
 
-	data.SendMessage("Share this link with your friends to invite them to the game:", true)
-
-	data.SendMessage(fmt.Sprintf(
-		"Link to join the game:\n%s/invite/%s/%s",
-		config.ShareWebAddress,
-		gameType,
-		sessionToken,
-	),
-		true)
-
-	data.SendMessage(fmt.Sprintf(
-		"Or show them this QR code:\nhttps://api.qrserver.com/v1/create-qr-code/?size=150x150&margin=10&data=%s/invite/%s/%s",
-		config.ShareWebAddress,
-		gameType,
-		sessionToken,
-	),
-		false)
+	qrCode, err := staticFunctions.GetInviteQrCodePng(&config, gameType, sessionToken)
+	if err != nil {
+		log.Printf("Can't generate QR code: %s", err.Error())
+		return true
+	}
+	staticFunctions.SendPhoto(staticData, data.ChatId, "invite.png", qrCode, data.Trans("invite_qr_code"))
 
 	return true
 }
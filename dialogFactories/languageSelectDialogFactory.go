@@ -4,7 +4,6 @@ import (
 	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialogFactory"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
 	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
 	"github.com/nicksnyder/go-i18n/i18n"
 )
@@ -23,7 +22,7 @@ func MakeLanguageSelectDialogFactory() dialogFactory.DialogFactory {
 }
 
 func applyNewLanguage(data *processing.ProcessData, newLang string) bool {
-	staticFunctions.GetDb(data.Static).SetUserLanguage(data.UserId, newLang)
+	staticFunctions.ChangeUserLanguage(data.Static, data.UserId, newLang)
 	data.Trans = staticFunctions.FindTransFunction(data.UserId, data.Static)
 	data.SubstituteMessage(data.Trans("language_changed"))
 	return true
@@ -35,11 +34,7 @@ func (factory *languageSelectDialogFactory) createVariants(staticData *processin
 	itemId := 0
 	itemsInRow := 2
 
-	config, configCastSuccess := staticData.Config.(static.StaticConfiguration)
-
-	if !configCastSuccess {
-		config = static.StaticConfiguration{}
-	}
+	config, _ := staticFunctions.GetConfig(staticData)
 
 	for _, lang := range config.AvailableLanguages {
 		variants = append(variants, dialog.Variant{
@@ -48,11 +48,8 @@ func connectToSession(data *processing.ProcessData) bool {
 }
 
 func createNewSession(data *processing.ProcessData) bool {
-	_, previousSessionId, wasInSession := staticFunctions.GetDb(data.Static).CreateSession(data.UserId)
+	staticFunctions.CreateSession(data.Static, data.UserId)
 	staticFunctions.SendSessionDialog(data)
-	if wasInSession {
-		staticFunctions.UpdateSessionDialogs(previousSessionId, data.Static)
-	}
 	return true
 }
 
@@ -61,11 +61,8 @@ func disconnectSession(sessionId int64, data *processing.ProcessData) bool {
 		return true
 	}
 
-	_, wasInSession := db.LeaveSession(data.UserId)
+	staticFunctions.LeaveSession(data.Static, data.UserId)
 	data.SubstituteDialog(data.Static.MakeDialogFn("ns", data.UserId, data.Trans, data.Static, nil))
-	if wasInSession {
-		staticFunctions.UpdateSessionDialogs(sessionId, data.Static)
-	}
 	return true
 }
 
@@ -15,11 +15,16 @@ func GetTextInputProcessorManager() dialogManager.TextInputProcessorManager {
 }
 
 func processConnectSession(additionalId int64, data *processing.ProcessData) bool {
-	isSuccessful := staticFunctions.ConnectToSession(data, data.Message)
+	isSuccessful, isSessionFull := staticFunctions.ConnectToSession(data, data.Message)
 	if isSuccessful {
 		return true
 	}
 
+	if isSessionFull {
+		data.SendMessage(data.Trans("session_is_full"), true)
+		return true
+	}
+
 	data.Static.SetUserStateTextProcessor(data.UserId, &processing.AwaitingTextProcessorData{
 		ProcessorId: "connectSession",
 	})
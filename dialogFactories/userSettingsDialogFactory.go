@@ -4,7 +4,6 @@ import (
 	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialogFactory"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
 	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
 	"github.com/nicksnyder/go-i18n/i18n"
 )
@@ -69,11 +68,7 @@ func (factory *userSettingsDialogFactory) MakeDialog(userId int64, trans i18n.Tr
 
 	language := db.GetUserLanguage(userId)
 
-	config, configCastSuccess := staticData.Config.(static.StaticConfiguration)
-
-	if !configCastSuccess {
-		config = static.StaticConfiguration{}
-	}
+	config, _ := staticFunctions.GetConfig(staticData)
 
 	langName := language
 
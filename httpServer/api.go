@@ -0,0 +1,485 @@
+package httpServer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"log"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	apiPrefix = "/api/v1/"
+	// the biggest request is a theme, it doesn't need more
+	maxApiRequestSize = 64 * 1024
+	// in characters, if not set in the config
+	defaultMaxThemeLength = 1000
+)
+
+//go:embed openapi.json
+var openApiSpec []byte
+
+type apiError struct {
+	// stable identifier for the clients, the message is only for people
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type okResponse struct {
+	Ok bool `json:"ok"`
+}
+
+type joinRequest struct {
+	GameId   string `json:"gameId"`
+	Language string `json:"language"`
+}
+
+type joinResponse struct {
+	PlayerToken string `json:"playerToken"`
+}
+
+type createRequest struct {
+	// optional, the language of the browser is good enough
+	Language string `json:"language"`
+}
+
+type createResponse struct {
+	PlayerToken string `json:"playerToken"`
+	GameId      string `json:"gameId"`
+}
+
+type languageRequest struct {
+	PlayerToken string `json:"playerToken"`
+	Language    string `json:"language"`
+}
+
+type participantInfo struct {
+	// "telegram" or "web"
+	Platform string `json:"platform"`
+	IsYou    bool   `json:"isYou"`
+}
+
+type inviteInfo struct {
+	GameType  string `json:"gameType"`
+	Link      string `json:"link"`
+	QrCodeUrl string `json:"qrCodeUrl"`
+}
+
+type languageInfo struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type sessionResponse struct {
+	GameId       string            `json:"gameId"`
+	IsWebHosted  bool              `json:"isWebHosted"`
+	Participants []participantInfo `json:"participants"`
+	Invites      []inviteInfo      `json:"invites"`
+	Language     string            `json:"language"`
+	Languages    []languageInfo    `json:"languages"`
+}
+
+type playerRequest struct {
+	PlayerToken string `json:"playerToken"`
+}
+
+type themeRequest struct {
+	PlayerToken string `json:"playerToken"`
+	Message     string `json:"message"`
+}
+
+type messagesResponse struct {
+	LastMessageIdx int      `json:"lastMessageIdx"`
+	Players        int64    `json:"players"`
+	Messages       []string `json:"messages"`
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Println("Error writing response: ", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, status int, code string, message string) {
+	writeJson(w, status, apiErrorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+// apiHandler rejects the requests with a wrong method with a JSON error like all the other API errors
+func apiHandler(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeApiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use "+method+" for this endpoint")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func decodeJsonRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxApiRequestSize)).Decode(request)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeApiError(w, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("The request can't be bigger than %d bytes", maxBytesErr.Limit))
+		return false
+	}
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_request", "Can't parse the request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// findPlayer writes the error response itself if the player can't play anymore
+func findPlayer(w http.ResponseWriter, db *database.SpyBotDb, playerToken string) (userId int64, sessionId int64, isFound bool) {
+	if !isPlayerTokenCorrect(playerToken) {
+		writeApiError(w, http.StatusBadRequest, "invalid_player_token", "Incorrect player token")
+		return
+	}
+
+	userId, isFound = db.GetWebUserId(playerToken)
+	if !isFound {
+		writeApiError(w, http.StatusNotFound, "player_not_found", "Player not found, has the game ended?")
+		return
+	}
+
+	sessionId, isFound = db.GetUserSession(userId)
+	if !isFound {
+		writeApiError(w, http.StatusNotFound, "session_not_found", "Player not in session, has the game ended?")
+	}
+	return
+}
+
+func apiJoinGame(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs, limits *apiLimits) {
+	var request joinRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	if request.GameId == "" {
+		writeApiError(w, http.StatusBadRequest, "invalid_game_id", "Incorrect game id, reload the page and try again")
+		return
+	}
+
+	sessionId, isFound := db.GetSessionIdFromToken(request.GameId)
+	if !isFound {
+		writeApiError(w, http.StatusNotFound, "game_not_found", "Game not found. Was it ended?")
+		return
+	}
+
+	if !limits.allowJoin(w, r, sessionId) {
+		return
+	}
+
+	playerToken := database.GenerateToken(playerTokenBytes)
+	hasAdded, isSessionFull := db.AddWebUserIfNotFull(sessionId, playerToken, staticFunctions.GetMaxPlayersInSession(staticData))
+	if isSessionFull {
+		writeApiError(w, http.StatusConflict, "session_full", "The game already has the maximum number of players")
+		return
+	}
+	if !hasAdded {
+		writeApiError(w, http.StatusInternalServerError, "join_failed", "Can't add new user, try again")
+		return
+	}
+
+	if request.Language != "" {
+		userId, _ := db.GetWebUserId(playerToken)
+		staticFunctions.ChangeUserLanguage(staticData, userId, request.Language)
+	}
+
+	staticFunctions.UpdateSessionDialogs(sessionId, staticData)
+
+	setPlayerTokenCookie(w, r, playerToken)
+	writeJson(w, http.StatusOK, joinResponse{PlayerToken: playerToken})
+}
+
+func apiCreateGame(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs, limits *apiLimits) {
+	var request createRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	if !limits.allowJoin(w, r, 0) {
+		return
+	}
+
+	sessionId := db.CreateWebHostedSession()
+
+	playerToken, hasAdded := addWebUser(db, sessionId)
+	if !hasAdded {
+		db.RemoveSession(sessionId)
+		writeApiError(w, http.StatusInternalServerError, "create_failed", "Can't create a new game, try again")
+		return
+	}
+
+	gameId, _ := db.GetTokenFromSessionId(sessionId)
+
+	if request.Language != "" {
+		userId, _ := db.GetWebUserId(playerToken)
+		// an unsupported browser language is not a reason to fail, the default one is used then
+		staticFunctions.ChangeUserLanguage(staticData, userId, request.Language)
+	}
+
+	setPlayerTokenCookie(w, r, playerToken)
+	writeJson(w, http.StatusOK, createResponse{
+		PlayerToken: playerToken,
+		GameId:      gameId,
+	})
+}
+
+func apiGetSession(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	userId, sessionId, isFound := findPlayer(w, db, requestPlayerToken(r, getPlayerTokenHeader(r)))
+	if !isFound {
+		return
+	}
+
+	db.UpdateWebUserActivity(userId)
+
+	config, _ := staticFunctions.GetConfig(staticData)
+	gameId, _ := db.GetTokenFromSessionId(sessionId)
+
+	response := sessionResponse{
+		GameId:       gameId,
+		IsWebHosted:  db.IsSessionWebHosted(sessionId),
+		Participants: []participantInfo{},
+		Invites:      []inviteInfo{},
+		Language:     staticFunctions.GetUserLanguageOrDefault(staticData, userId),
+		Languages:    []languageInfo{},
+	}
+
+	for _, participant := range db.GetSessionParticipants(sessionId) {
+		platform := "telegram"
+		if participant.IsWebUser {
+			platform = "web"
+		}
+		response.Participants = append(response.Participants, participantInfo{
+			Platform: platform,
+			IsYou:    participant.UserId == userId,
+		})
+	}
+
+	for _, gameType := range staticFunctions.InviteGameTypes {
+		response.Invites = append(response.Invites, inviteInfo{
+			GameType:  gameType,
+			Link:      staticFunctions.GetInviteLink(&config, gameType, gameId),
+			QrCodeUrl: getInviteQrCodePath(gameType, gameId),
+		})
+	}
+
+	for _, lang := range config.AvailableLanguages {
+		response.Languages = append(response.Languages, languageInfo{Key: lang.Key, Name: lang.Name})
+	}
+
+	writeJson(w, http.StatusOK, response)
+}
+
+func apiSetLanguage(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	var request languageRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	userId, _, isFound := findPlayer(w, db, requestPlayerToken(r, request.PlayerToken))
+	if !isFound {
+		return
+	}
+
+	db.UpdateWebUserActivity(userId)
+
+	if !staticFunctions.ChangeUserLanguage(staticData, userId, request.Language) {
+		writeApiError(w, http.StatusBadRequest, "invalid_language", "This language is not supported")
+		return
+	}
+
+	writeJson(w, http.StatusOK, okResponse{Ok: true})
+}
+
+func apiGetMessages(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb) {
+	query := r.URL.Query()
+
+	userId, sessionId, isFound := findPlayer(w, db, requestPlayerToken(r, getPlayerTokenHeader(r)))
+	if !isFound {
+		return
+	}
+
+	db.UpdateWebUserActivity(userId)
+
+	lastMessageIdx, err := strconv.Atoi(query.Get("lastMessageIdx"))
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_last_message_idx", "Incorrect last message index")
+		return
+	}
+
+	messages, newLastIdx := db.GetNewRecentWebMessages(userId, lastMessageIdx)
+	if messages == nil {
+		// to always have an array in the response
+		messages = []string{}
+	}
+
+	writeJson(w, http.StatusOK, messagesResponse{
+		LastMessageIdx: newLastIdx,
+		Players:        db.GetUsersCountInSession(sessionId, false),
+		Messages:       messages,
+	})
+}
+
+func apiSendTheme(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	var request themeRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	userId, sessionId, isFound := findPlayer(w, db, requestPlayerToken(r, request.PlayerToken))
+	if !isFound {
+		return
+	}
+
+	db.MarkUserActive(userId)
+
+	if request.Message == "" {
+		writeApiError(w, http.StatusBadRequest, "empty_message", "The message is empty")
+		return
+	}
+
+	config, _ := staticFunctions.GetConfig(staticData)
+	maxThemeLength := valueOrDefault(config.MaxThemeLength, defaultMaxThemeLength)
+	if utf8.RuneCountInString(request.Message) > maxThemeLength {
+		writeApiError(w, http.StatusBadRequest, "message_too_long", fmt.Sprintf("The message can't be longer than %d characters", maxThemeLength))
+		return
+	}
+
+	if !staticFunctions.SendThemeToOthers(staticData, sessionId, userId, request.Message) {
+		writeApiError(w, http.StatusConflict, "not_enough_players", "Not enough players")
+		return
+	}
+
+	writeJson(w, http.StatusOK, okResponse{Ok: true})
+}
+
+func apiSendSpyfallLocation(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	var request playerRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	userId, sessionId, isFound := findPlayer(w, db, requestPlayerToken(r, request.PlayerToken))
+	if !isFound {
+		return
+	}
+
+	db.MarkUserActive(userId)
+
+	if !staticFunctions.SendSpyfallLocationToAll(staticData, sessionId) {
+		writeApiError(w, http.StatusConflict, "not_enough_players", "Not enough players")
+		return
+	}
+
+	writeJson(w, http.StatusOK, okResponse{Ok: true})
+}
+
+func apiSendNumbers(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	var request playerRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	userId, sessionId, isFound := findPlayer(w, db, requestPlayerToken(r, request.PlayerToken))
+	if !isFound {
+		return
+	}
+
+	db.MarkUserActive(userId)
+
+	if db.GetUsersCountInSession(sessionId, false) < 2 {
+		writeApiError(w, http.StatusConflict, "not_enough_players", "Not enough players")
+		return
+	}
+
+	staticFunctions.GiveRandomNumbersToPlayers(staticData, sessionId)
+
+	writeJson(w, http.StatusOK, okResponse{Ok: true})
+}
+
+func apiLeaveGame(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	var request playerRequest
+	if !decodeJsonRequest(w, r, &request) {
+		return
+	}
+
+	playerToken := requestPlayerToken(r, request.PlayerToken)
+	userId, sessionId, isFound := findPlayer(w, db, playerToken)
+	if !isFound {
+		return
+	}
+
+	staticFunctions.RemoveWebPlayer(staticData, playerToken, userId, sessionId)
+
+	if getPlayerTokenCookie(r) == playerToken {
+		clearPlayerTokenCookie(w, r)
+	}
+
+	writeJson(w, http.StatusOK, okResponse{Ok: true})
+}
+
+func serveOpenApiSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(openApiSpec)
+	if err != nil {
+		log.Println("Error serving OpenAPI spec: ", err)
+	}
+}
+
+func registerApiHandlers(mainMux *http.ServeMux, db *database.SpyBotDb, staticData *processing.StaticProccessStructs, limits *apiLimits) {
+	broker := staticFunctions.GetWebEventsBroker(staticData)
+
+	mux := http.NewServeMux()
+	mainMux.Handle(apiPrefix, limits.limitRequests(checkCsrf(mux)))
+
+	mux.HandleFunc(apiPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeApiError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+	})
+	mux.HandleFunc(apiPrefix+"openapi.json", apiHandler(http.MethodGet, serveOpenApiSpec))
+	mux.HandleFunc(apiPrefix+"create", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiCreateGame(w, r, db, staticData, limits)
+	}))
+	mux.HandleFunc(apiPrefix+"join", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiJoinGame(w, r, db, staticData, limits)
+	}))
+	mux.HandleFunc(apiPrefix+"session", apiHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		apiGetSession(w, r, db, staticData)
+	}))
+	mux.HandleFunc(apiPrefix+"language", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiSetLanguage(w, r, db, staticData)
+	}))
+	mux.HandleFunc(apiPrefix+"messages", apiHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		apiGetMessages(w, r, db)
+	}))
+	mux.HandleFunc(apiPrefix+"events", apiHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		apiEvents(w, r, db, broker)
+	}))
+	mux.HandleFunc(apiPrefix+"theme", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiSendTheme(w, r, db, staticData)
+	}))
+	mux.HandleFunc(apiPrefix+"spyfall", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiSendSpyfallLocation(w, r, db, staticData)
+	}))
+	mux.HandleFunc(apiPrefix+"numbers", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiSendNumbers(w, r, db, staticData)
+	}))
+	mux.HandleFunc(apiPrefix+"leave", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiLeaveGame(w, r, db, staticData)
+	}))
+}
@@ -0,0 +1,56 @@
+package httpServer
+
+import (
+	"crypto/subtle"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"net/http"
+	"regexp"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfTokenBytes = 32
+)
+
+var csrfTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// ensureCsrfCookie gives the browser a token that the pages send back in a header,
+// other sites can make the browser send the cookie but can't read the token from the pages
+func ensureCsrfCookie(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && csrfTokenRegexp.MatchString(cookie.Value) {
+		return cookie.Value
+	}
+
+	token := database.GenerateToken(csrfTokenBytes)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   playerTokenCookieMaxAge,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// checkCsrf rejects the requests that change something using the player cookie without the token of the pages,
+// API clients that pass playerToken themselves don't send the cookie and don't need the token
+func checkCsrf(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || getPlayerTokenCookie(r) == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookieName)
+		headerToken := r.Header.Get(csrfHeaderName)
+		if err != nil || headerToken == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(headerToken)) != 1 {
+			writeApiError(w, http.StatusForbidden, "csrf_token_mismatch", "The request didn't come from the game page, reload the page and try again")
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
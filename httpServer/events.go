@@ -0,0 +1,138 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/gameraccoon/telegram-spy-game-bot/webEvents"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the connection is checked this often, it also keeps proxies from closing an idle stream
+const eventsHeartbeatInterval = 15 * time.Second
+
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (stream *eventStream) send(event string, id string, value interface{}) bool {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Println("Error encoding event: ", err)
+		return false
+	}
+
+	if id != "" {
+		_, err = fmt.Fprintf(stream.w, "id: %s\n", id)
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(stream.w, "event: %s\ndata: %s\n\n", event, data)
+	}
+	stream.flusher.Flush()
+	return err == nil
+}
+
+func (stream *eventStream) ping() bool {
+	_, err := fmt.Fprint(stream.w, ": ping\n\n")
+	stream.flusher.Flush()
+	return err == nil
+}
+
+// apiEvents streams the new messages and the player count to the page as Server-Sent Events,
+// the page falls back to polling /messages if the stream is not available
+func apiEvents(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, broker *webEvents.Broker) {
+	if broker == nil {
+		writeApiError(w, http.StatusServiceUnavailable, "events_unavailable", "Events are not available, use polling")
+		return
+	}
+
+	flusher, isFlusher := w.(http.Flusher)
+	if !isFlusher {
+		writeApiError(w, http.StatusServiceUnavailable, "events_unavailable", "Events are not available, use polling")
+		return
+	}
+
+	query := r.URL.Query()
+
+	userId, _, isFound := findPlayer(w, db, requestPlayerToken(r, getPlayerTokenHeader(r)))
+	if !isFound {
+		return
+	}
+
+	// the browser sends the id of the last received event when it reconnects
+	lastMessageIdxStr := r.Header.Get("Last-Event-ID")
+	if lastMessageIdxStr == "" {
+		lastMessageIdxStr = query.Get("lastMessageIdx")
+	}
+	lastMessageIdx, err := strconv.Atoi(lastMessageIdxStr)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_last_message_idx", "Incorrect last message index")
+		return
+	}
+
+	// subscribe before reading the state to not miss the changes in between
+	signals, unsubscribe := broker.Subscribe(userId)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers the responses by default
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, flusher: flusher}
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	lastPlayersCount := int64(-1)
+	isChanged := true
+	for {
+		db.UpdateWebUserActivity(userId)
+
+		sessionId, isInSession := db.GetUserSession(userId)
+		if !isInSession {
+			stream.send("ended", "", apiErrorResponse{Error: apiError{Code: "session_not_found", Message: "The game has ended"}})
+			return
+		}
+
+		if isChanged {
+			messages, newLastIdx := db.GetNewRecentWebMessages(userId, lastMessageIdx)
+			playersCount := db.GetUsersCountInSession(sessionId, false)
+
+			if len(messages) > 0 || newLastIdx != lastMessageIdx || playersCount != lastPlayersCount {
+				if messages == nil {
+					messages = []string{}
+				}
+				isSent := stream.send("messages", strconv.Itoa(newLastIdx), messagesResponse{
+					LastMessageIdx: newLastIdx,
+					Players:        playersCount,
+					Messages:       messages,
+				})
+				if !isSent {
+					return
+				}
+				lastMessageIdx = newLastIdx
+				lastPlayersCount = playersCount
+			}
+		}
+
+		select {
+		case <-signals:
+			isChanged = true
+		case <-heartbeat.C:
+			isChanged = false
+			if !stream.ping() {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-broker.Stopped():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package httpServer
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	languageCookieName = "language"
+	// the choice of the language is kept for a year
+	languageCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+type acceptedLanguage struct {
+	lang    string
+	quality float64
+}
+
+// parseAcceptLanguage returns the languages from the Accept-Language header, the preferred ones first
+func parseAcceptLanguage(header string) (languages []string) {
+	var accepted []acceptedLanguage
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if qualityStr, hasQuality := strings.CutPrefix(strings.TrimSpace(params), "q="); hasQuality {
+			parsedQuality, err := strconv.ParseFloat(qualityStr, 64)
+			if err != nil || parsedQuality <= 0 {
+				continue
+			}
+			quality = parsedQuality
+		}
+
+		accepted = append(accepted, acceptedLanguage{lang: lang, quality: quality})
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	for _, language := range accepted {
+		languages = append(languages, language.lang)
+	}
+	return
+}
+
+// findRequestLanguage picks the language chosen on the page, then the one from the browser settings
+func findRequestLanguage(r *http.Request, config *static.StaticConfiguration) (langKey string, isChosen bool) {
+	if langKey, isFound := staticFunctions.FindAvailableLanguage(config, r.URL.Query().Get("lang")); isFound {
+		return langKey, true
+	}
+
+	if cookie, err := r.Cookie(languageCookieName); err == nil {
+		if langKey, isFound := staticFunctions.FindAvailableLanguage(config, cookie.Value); isFound {
+			return langKey, false
+		}
+	}
+
+	for _, lang := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if langKey, isFound := staticFunctions.FindAvailableLanguage(config, lang); isFound {
+			return langKey, false
+		}
+	}
+
+	return config.DefaultLanguage, false
+}
+
+func setLanguageCookie(w http.ResponseWriter, r *http.Request, langKey string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     languageCookieName,
+		Value:    langKey,
+		Path:     "/",
+		MaxAge:   languageCookieMaxAge,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func getRequestTrans(r *http.Request, staticData *processing.StaticProccessStructs) i18n.TranslateFunc {
+	config, _ := staticFunctions.GetConfig(staticData)
+	langKey, _ := findRequestLanguage(r, &config)
+	return staticFunctions.GetTranslator(staticData, langKey)
+}
+
+// pageData is what the templates of the pages can use, the texts are taken with {{.T "id"}}
+type pageData struct {
+	Lang      string
+	Languages []languageInfo
+	// show the links to choose another language
+	ShowLanguages bool
+	CsrfToken     string
+	// the game of the invite link or of the player
+	GameId       string
+	GameType     string
+	PlayersCount int64
+	// opens the bot, or joins the game from Telegram on the invite page
+	TelegramLink string
+	// the names of the Spyfall locations, three in a row
+	SpyfallLocationRows [][]string
+	trans               i18n.TranslateFunc
+}
+
+func makePageData(staticData *processing.StaticProccessStructs, langKey string) *pageData {
+	config, _ := staticFunctions.GetConfig(staticData)
+	trans := staticFunctions.GetTranslator(staticData, langKey)
+
+	data := &pageData{
+		Lang:         langKey,
+		TelegramLink: staticFunctions.GetTelegramBotLink(staticData.BotName),
+		trans:        trans,
+	}
+
+	for _, lang := range config.AvailableLanguages {
+		data.Languages = append(data.Languages, languageInfo{Key: lang.Key, Name: lang.Name})
+	}
+
+	const locationsInRow = 3
+	for i, location := range config.SpyfallLocations {
+		if i%locationsInRow == 0 {
+			data.SpyfallLocationRows = append(data.SpyfallLocationRows, nil)
+		}
+		lastRow := &data.SpyfallLocationRows[len(data.SpyfallLocationRows)-1]
+		*lastRow = append(*lastRow, trans("spyfall_loc_"+location.LocationId))
+	}
+
+	return data
+}
+
+// T translates a text of the page, the arguments are pairs of names and values,
+// the scripts pass placeholders as values to put the numbers in later
+func (data *pageData) T(id string, args ...string) string {
+	if len(args) == 0 {
+		return data.trans(id)
+	}
+
+	translationMap := make(map[string]interface{})
+	for i := 0; i+1 < len(args); i += 2 {
+		translationMap[args[i]] = args[i+1]
+	}
+	return data.trans(id, translationMap)
+}
@@ -0,0 +1,15 @@
+package httpServer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal([]string{"ru-RU", "ru", "en"}, parseAcceptLanguage("ru-RU,ru;q=0.9,en;q=0.8"))
+	assert.Equal([]string{"en", "de"}, parseAcceptLanguage("de;q=0.5, en, *;q=0.1"))
+	assert.Equal([]string{"fr"}, parseAcceptLanguage("es;q=0, fr, it;q=wrong"))
+	assert.Empty(parseAcceptLanguage(""))
+}
@@ -0,0 +1,142 @@
+package httpServer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/data"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// every page is rendered inside the layout, the pages define its "style", "script" and "content"
+const layoutFileName = "layout.html"
+
+// the pages are templates that get pageData, the texts are in the language of the visitor
+type webCaches struct {
+	indexHtml           *template.Template
+	inviteHtml          *template.Template
+	inviteNoSessionHtml *template.Template
+	userHtml            *template.Template
+}
+
+func loadCaches(files fs.FS) (caches webCaches, err error) {
+	layout, err := template.ParseFS(files, layoutFileName)
+	if err != nil {
+		err = fmt.Errorf("error while parsing %s: %w", layoutFileName, err)
+		return
+	}
+
+	pages := []struct {
+		fileName string
+		content  **template.Template
+	}{
+		{"index.html", &caches.indexHtml},
+		{"invite.html", &caches.inviteHtml},
+		{"invite_no_session.html", &caches.inviteNoSessionHtml},
+		{"user.html", &caches.userHtml},
+	}
+
+	for _, page := range pages {
+		pageTemplate, cloneErr := layout.Clone()
+		if cloneErr != nil {
+			err = cloneErr
+			return
+		}
+		_, parseErr := pageTemplate.ParseFS(files, page.fileName)
+		if parseErr != nil {
+			err = fmt.Errorf("error while parsing %s: %w", page.fileName, parseErr)
+			return
+		}
+		*page.content = pageTemplate
+	}
+
+	return
+}
+
+// HtmlCache keeps the parsed pages, they can be reloaded while the server is running
+type HtmlCache struct {
+	files fs.FS
+	// the pages are parsed again for every request to see the changes without restarting
+	isDevMode bool
+	caches    atomic.Pointer[webCaches]
+}
+
+// LoadHtmlCache uses the pages built into the binary if htmlDir is empty,
+// otherwise the pages are read from htmlDir in the dev mode
+func LoadHtmlCache(htmlDir string) (cache *HtmlCache, err error) {
+	cache = &HtmlCache{}
+	if htmlDir == "" {
+		cache.files, err = fs.Sub(data.HtmlFiles, "html")
+		if err != nil {
+			return
+		}
+	} else {
+		cache.files = os.DirFS(htmlDir)
+		cache.isDevMode = true
+	}
+	err = cache.Reload()
+	return
+}
+
+// Reload keeps the previous pages if any of the new ones can't be loaded
+func (cache *HtmlCache) Reload() error {
+	caches, err := loadCaches(cache.files)
+	if err != nil {
+		return err
+	}
+	cache.caches.Store(&caches)
+	return nil
+}
+
+func (cache *HtmlCache) get() *webCaches {
+	if cache.isDevMode {
+		err := cache.Reload()
+		if err != nil {
+			log.Printf("Can't reload the web pages, showing the previous ones: %s", err.Error())
+		}
+	}
+	return cache.caches.Load()
+}
+
+// makeRequestPageData is for the pages outside of the game, they are shown in the language of the visitor
+// and let them choose another one, the choice is remembered
+func makeRequestPageData(w http.ResponseWriter, r *http.Request, staticData *processing.StaticProccessStructs) *pageData {
+	config, _ := staticFunctions.GetConfig(staticData)
+	langKey, isChosen := findRequestLanguage(r, &config)
+	if isChosen {
+		setLanguageCookie(w, r, langKey)
+	}
+
+	data := makePageData(staticData, langKey)
+	data.ShowLanguages = true
+	return data
+}
+
+func renderPage(w http.ResponseWriter, r *http.Request, page *template.Template, data *pageData) {
+	data.CsrfToken = ensureCsrfCookie(w, r)
+
+	// render fully before sending to not send half of a page in case of an error
+	var pageHtml bytes.Buffer
+	err := page.ExecuteTemplate(&pageHtml, "layout", data)
+	if err != nil {
+		log.Printf("Error rendering page %s: %s", page.Name(), err.Error())
+		http.Error(w, data.T("web_error_page"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", data.Lang)
+	// the pages have the CSRF token of the browser and depend on the language
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Language, Cookie")
+	_, err = w.Write(pageHtml.Bytes())
+	if err != nil {
+		log.Println("Error serving page: ", err)
+	}
+}
@@ -0,0 +1,102 @@
+package httpServer
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func renderTestPage(t *testing.T, page *template.Template) string {
+	var result bytes.Buffer
+	require.NoError(t, page.ExecuteTemplate(&result, "layout", &pageData{
+		Lang:  "en-us",
+		trans: func(id string, args ...interface{}) string { return id },
+	}))
+	return result.String()
+}
+
+func TestBuiltInPages(t *testing.T) {
+	assert := require.New(t)
+
+	cache, err := LoadHtmlCache("")
+	assert.NoError(err)
+	assert.False(cache.isDevMode)
+
+	caches := cache.get()
+	assert.Contains(renderTestPage(t, caches.indexHtml), "web_index_intro")
+	assert.Contains(renderTestPage(t, caches.userHtml), "leave-game-button")
+}
+
+func TestDevModePagesReload(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writePage := func(fileName string, content string) {
+		assert.NoError(os.WriteFile(filepath.Join(dir, fileName), []byte(content), 0600))
+	}
+	writePage(layoutFileName, `{{define "layout"}}<html lang="{{.Lang}}">{{block "content" .}}{{end}}</html>{{end}}`)
+	writePage("index.html", `{{define "content"}}index{{end}}`)
+	writePage("invite.html", `{{define "content"}}invite{{end}}`)
+	writePage("invite_no_session.html", `{{define "content"}}no session{{end}}`)
+	writePage("user.html", `{{define "content"}}user{{end}}`)
+
+	cache, err := LoadHtmlCache(dir)
+	assert.NoError(err)
+	assert.True(cache.isDevMode)
+	assert.Equal(`<html lang="en-us">index</html>`, renderTestPage(t, cache.get().indexHtml))
+
+	// the changes are seen without restarting
+	writePage("index.html", `{{define "content"}}changed{{end}}`)
+	assert.Equal(`<html lang="en-us">changed</html>`, renderTestPage(t, cache.get().indexHtml))
+
+	// a broken page doesn't break the pages that were loaded before
+	writePage("user.html", `{{define "content"}}{{.Unclosed{{end}}`)
+	assert.Equal(`<html lang="en-us">changed</html>`, renderTestPage(t, cache.get().indexHtml))
+	assert.Error(cache.Reload())
+}
+
+func TestCsrfCheck(t *testing.T) {
+	assert := require.New(t)
+
+	handler := checkCsrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method string, cookies []*http.Cookie, headerToken string) int {
+		request := httptest.NewRequest(method, "/api/v1/leave", nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		if headerToken != "" {
+			request.Header.Set(csrfHeaderName, headerToken)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	recorder := httptest.NewRecorder()
+	token := ensureCsrfCookie(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Regexp(csrfTokenRegexp, token)
+
+	playerCookie := &http.Cookie{Name: playerTokenCookieName, Value: "player"}
+	csrfCookie := &http.Cookie{Name: csrfCookieName, Value: token}
+
+	// the API clients without the cookie and the requests that change nothing are not checked
+	assert.Equal(http.StatusOK, serve(http.MethodPost, nil, ""))
+	assert.Equal(http.StatusOK, serve(http.MethodGet, []*http.Cookie{playerCookie}, ""))
+
+	assert.Equal(http.StatusForbidden, serve(http.MethodPost, []*http.Cookie{playerCookie}, ""))
+	assert.Equal(http.StatusForbidden, serve(http.MethodPost, []*http.Cookie{playerCookie}, token))
+	assert.Equal(http.StatusForbidden, serve(http.MethodPost, []*http.Cookie{playerCookie, csrfCookie}, "wrong"))
+	assert.Equal(http.StatusOK, serve(http.MethodPost, []*http.Cookie{playerCookie, csrfCookie}, token))
+
+	// the existing token is kept
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.AddCookie(csrfCookie)
+	recorder = httptest.NewRecorder()
+	assert.Equal(token, ensureCsrfCookie(recorder, request))
+	assert.Empty(recorder.Result().Cookies())
+}
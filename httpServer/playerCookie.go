@@ -0,0 +1,69 @@
+package httpServer
+
+import (
+	"net/http"
+	"regexp"
+)
+
+const (
+	playerTokenCookieName = "player_token"
+	// a week is enough to come back to an evening game
+	playerTokenCookieMaxAge = 7 * 24 * 60 * 60
+	// 256 bits
+	playerTokenBytes = 32
+	// the GET requests have no body, the token is not passed in the URL where it would be logged by proxies and servers
+	playerTokenHeaderName = "X-Player-Token"
+)
+
+// the current tokens are 43 characters long, the numeric ones from the older versions are shorter
+var playerTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// the scripts of the pages don't need the token, so it is not readable from them
+func setPlayerTokenCookie(w http.ResponseWriter, r *http.Request, playerToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     playerTokenCookieName,
+		Value:    playerToken,
+		Path:     "/",
+		MaxAge:   playerTokenCookieMaxAge,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearPlayerTokenCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     playerTokenCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func getPlayerTokenCookie(r *http.Request) string {
+	cookie, err := r.Cookie(playerTokenCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// getPlayerTokenHeader returns the token that API clients pass in the GET requests
+func getPlayerTokenHeader(r *http.Request) string {
+	return r.Header.Get(playerTokenHeaderName)
+}
+
+// requestPlayerToken prefers the token that API clients pass explicitly, the web pages rely on the cookie
+func requestPlayerToken(r *http.Request, explicitToken string) string {
+	if explicitToken != "" {
+		return explicitToken
+	}
+	return getPlayerTokenCookie(r)
+}
+
+func isPlayerTokenCorrect(playerToken string) bool {
+	return playerTokenRegexp.MatchString(playerToken)
+}
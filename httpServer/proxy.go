@@ -0,0 +1,111 @@
+package httpServer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type forwardedHttpsKeyType struct{}
+
+// set in the context of the requests that came to a trusted proxy over HTTPS
+var forwardedHttpsKey = forwardedHttpsKeyType{}
+
+// ParseTrustedProxy accepts a single address ("10.0.0.1") or a network ("10.0.0.0/8")
+func ParseTrustedProxy(proxy string) (*net.IPNet, error) {
+	if strings.Contains(proxy, "/") {
+		_, network, err := net.ParseCIDR(proxy)
+		return network, err
+	}
+
+	ip := net.ParseIP(proxy)
+	if ip == nil {
+		return nil, fmt.Errorf("\"%s\" is not an IP address or a network", proxy)
+	}
+	bitsCount := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bitsCount = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bitsCount, bitsCount)}, nil
+}
+
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(proxies []string) (networks trustedProxies, err error) {
+	for _, proxy := range proxies {
+		network, parseErr := ParseTrustedProxy(proxy)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+func (proxies trustedProxies) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// findClientIp goes through X-Forwarded-For from the closest hop, the first address
+// that is not a trusted proxy is the client, the ones before it could be forged
+func (proxies trustedProxies) findClientIp(remoteIp string, forwardedFor []string) string {
+	var hops []string
+	for _, header := range forwardedFor {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	clientIp := remoteIp
+	for i := len(hops) - 1; i >= 0 && proxies.isTrusted(clientIp); i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		clientIp = hops[i]
+	}
+	return clientIp
+}
+
+// handleForwardedHeaders replaces the address of a trusted proxy with the address of the client,
+// the headers from other addresses are ignored as anyone can send them
+func handleForwardedHeaders(proxies trustedProxies, handler http.Handler) http.Handler {
+	if len(proxies) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteIp := getClientIp(r)
+		if !proxies.isTrusted(remoteIp) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		// the closest proxy knows how the client connected to it
+		if r.TLS == nil && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			ctx = context.WithValue(ctx, forwardedHttpsKey, true)
+		}
+
+		forwardedRequest := r.WithContext(ctx)
+		forwardedRequest.RemoteAddr = proxies.findClientIp(remoteIp, r.Header.Values("X-Forwarded-For"))
+		handler.ServeHTTP(w, forwardedRequest)
+	})
+}
+
+// isSecureRequest tells if the client connected over HTTPS, to us or to a trusted proxy
+func isSecureRequest(r *http.Request) bool {
+	isForwardedHttps, _ := r.Context().Value(forwardedHttpsKey).(bool)
+	return r.TLS != nil || isForwardedHttps
+}
@@ -0,0 +1,70 @@
+package httpServer
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type forwardedResult struct {
+	clientIp string
+	isSecure bool
+}
+
+func serveForwarded(proxies trustedProxies, remoteAddr string, headers map[string]string) (result forwardedResult) {
+	handler := handleForwardedHeaders(proxies, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result = forwardedResult{clientIp: getClientIp(r), isSecure: isSecureRequest(r)}
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	return
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	assert := require.New(t)
+
+	proxies, err := parseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8", "::1"})
+	assert.NoError(err)
+	assert.True(proxies.isTrusted("127.0.0.1"))
+	assert.False(proxies.isTrusted("127.0.0.2"))
+	assert.True(proxies.isTrusted("10.20.30.40"))
+	assert.True(proxies.isTrusted("::1"))
+	assert.False(proxies.isTrusted("not an ip"))
+
+	_, err = parseTrustedProxies([]string{"proxy.example.com"})
+	assert.Error(err)
+	_, err = parseTrustedProxies([]string{"10.0.0.0/40"})
+	assert.Error(err)
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	assert := require.New(t)
+
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	assert.NoError(err)
+
+	forwarded := map[string]string{
+		"X-Forwarded-For":   "1.2.3.4, 5.6.7.8, 10.0.0.2",
+		"X-Forwarded-Proto": "https",
+	}
+
+	// the first address from the end that is not a proxy is the client, the rest could be sent by them
+	assert.Equal(forwardedResult{clientIp: "5.6.7.8", isSecure: true}, serveForwarded(proxies, "10.0.0.1:4000", forwarded))
+
+	// anyone else can't change the address or the scheme
+	assert.Equal(forwardedResult{clientIp: "5.6.7.8", isSecure: false}, serveForwarded(proxies, "5.6.7.8:4000", forwarded))
+	assert.Equal(forwardedResult{clientIp: "10.0.0.1", isSecure: false}, serveForwarded(nil, "10.0.0.1:4000", forwarded))
+
+	// a request from the proxy itself
+	assert.Equal(forwardedResult{clientIp: "10.0.0.1", isSecure: false}, serveForwarded(proxies, "10.0.0.1:4000", nil))
+
+	assert.Equal(forwardedResult{clientIp: "10.0.0.2", isSecure: false}, serveForwarded(proxies, "10.0.0.1:4000", map[string]string{
+		"X-Forwarded-For": "garbage, 10.0.0.2",
+	}))
+}
@@ -0,0 +1,67 @@
+package httpServer
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const qrCodePrefix = "/qr/"
+
+// getInviteQrCodePath is relative to work in LAN setups where shareWebAddress is not reachable
+func getInviteQrCodePath(gameType string, sessionToken string) string {
+	return qrCodePrefix + url.PathEscape(sessionToken) + ".png?game=" + url.QueryEscape(gameType)
+}
+
+// qrCodeImage serves the QR code of the invite link of an existing session,
+// the game type is taken from the "game" parameter, spyfall if not set
+func qrCodeImage(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
+	trans := getRequestTrans(r, staticData)
+
+	if r.Method != "GET" {
+		http.Error(w, trans("web_error_method"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionToken, hasExtension := strings.CutSuffix(r.URL.Path[len(qrCodePrefix):], ".png")
+	if !hasExtension || sessionToken == "" || strings.Contains(sessionToken, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	gameType := r.URL.Query().Get("game")
+	if gameType == "" {
+		gameType = staticFunctions.InviteGameTypes[0]
+	} else if !slices.Contains(staticFunctions.InviteGameTypes, gameType) {
+		http.Error(w, trans("web_error_game_type"), http.StatusBadRequest)
+		return
+	}
+
+	// not a general purpose QR code generator
+	_, isFound := db.GetSessionIdFromToken(sessionToken)
+	if !isFound {
+		http.NotFound(w, r)
+		return
+	}
+
+	config, _ := staticFunctions.GetConfig(staticData)
+	image, err := staticFunctions.GetInviteQrCodePng(&config, gameType, sessionToken)
+	if err != nil {
+		log.Printf("Can't generate QR code: %s", err.Error())
+		http.Error(w, trans("web_error_qr_code"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	// the token is a secret of the players, the image shouldn't stay in shared caches
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	_, err = w.Write(image)
+	if err != nil {
+		log.Println("Error serving QR code: ", err)
+	}
+}
@@ -0,0 +1,156 @@
+package httpServer
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultApiRequestsPerMinutePerIp = 300
+	defaultJoinsPerMinutePerIp       = 10
+	defaultJoinsPerMinutePerSession  = 30
+	// the buckets that were not used for this time are full again and can be forgotten
+	rateLimiterCleanupInterval = 10 * time.Minute
+)
+
+type rateBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+// rateLimiter is a token bucket per key, a key can do up to perMinute requests at once
+// and then one more every 1/perMinute of a minute
+type rateLimiter struct {
+	mutex       sync.Mutex
+	buckets     map[string]*rateBucket
+	lastCleanup time.Time
+}
+
+func makeRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:     make(map[string]*rateBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of the key, if it is not allowed it also returns how long to wait
+func (limiter *rateLimiter) allow(key string, perMinute int, now time.Time) (isAllowed bool, retryAfter time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if now.Sub(limiter.lastCleanup) > rateLimiterCleanupInterval {
+		limiter.removeIdleBucketsUnsafe(now)
+	}
+
+	capacity := float64(perMinute)
+	tokensPerSecond := capacity / 60
+
+	bucket, isFound := limiter.buckets[key]
+	if !isFound {
+		bucket = &rateBucket{tokens: capacity, lastUpdate: now}
+		limiter.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.lastUpdate).Seconds()*tokensPerSecond)
+	bucket.lastUpdate = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / tokensPerSecond * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+func (limiter *rateLimiter) removeIdleBucketsUnsafe(now time.Time) {
+	for key, bucket := range limiter.buckets {
+		if now.Sub(bucket.lastUpdate) > rateLimiterCleanupInterval {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastCleanup = now
+}
+
+// apiLimits keeps the state of all the limits of the web API, the numbers are taken from the current config
+type apiLimits struct {
+	staticData *processing.StaticProccessStructs
+	requests   *rateLimiter
+	ipJoins    *rateLimiter
+	// the phantom players from many addresses still can't flood one game
+	sessionJoins *rateLimiter
+}
+
+func makeApiLimits(staticData *processing.StaticProccessStructs) *apiLimits {
+	return &apiLimits{
+		staticData:   staticData,
+		requests:     makeRateLimiter(),
+		ipJoins:      makeRateLimiter(),
+		sessionJoins: makeRateLimiter(),
+	}
+}
+
+func valueOrDefault(value int, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func getClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeRateLimitError(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeApiError(w, http.StatusTooManyRequests, "too_many_requests", message)
+}
+
+// limitRequests rejects the requests of the addresses that send too many of them
+func (limits *apiLimits) limitRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, _ := staticFunctions.GetConfig(limits.staticData)
+		perMinute := valueOrDefault(config.ApiRequestsPerMinutePerIp, defaultApiRequestsPerMinutePerIp)
+
+		isAllowed, retryAfter := limits.requests.allow(getClientIp(r), perMinute, time.Now())
+		if !isAllowed {
+			writeRateLimitError(w, retryAfter, "Too many requests, try again later")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// allowJoin writes the error response itself if a new player can't be added now,
+// sessionId is zero for new games
+func (limits *apiLimits) allowJoin(w http.ResponseWriter, r *http.Request, sessionId int64) bool {
+	config, _ := staticFunctions.GetConfig(limits.staticData)
+	now := time.Now()
+
+	isAllowed, retryAfter := limits.ipJoins.allow(getClientIp(r), valueOrDefault(config.JoinsPerMinutePerIp, defaultJoinsPerMinutePerIp), now)
+	if !isAllowed {
+		writeRateLimitError(w, retryAfter, "Too many games joined from this address, try again later")
+		return false
+	}
+
+	if sessionId == 0 {
+		return true
+	}
+
+	isAllowed, retryAfter = limits.sessionJoins.allow(strconv.FormatInt(sessionId, 10), valueOrDefault(config.JoinsPerMinutePerSession, defaultJoinsPerMinutePerSession), now)
+	if !isAllowed {
+		writeRateLimitError(w, retryAfter, "Too many players are joining this game, try again later")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,37 @@
+package httpServer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert := require.New(t)
+
+	limiter := makeRateLimiter()
+	now := time.Now()
+
+	// the whole minute budget can be used at once
+	for i := 0; i < 3; i++ {
+		isAllowed, _ := limiter.allow("1.2.3.4", 3, now)
+		assert.True(isAllowed)
+	}
+	isAllowed, retryAfter := limiter.allow("1.2.3.4", 3, now)
+	assert.False(isAllowed)
+	assert.Equal(20*time.Second, retryAfter)
+
+	// the other keys have their own budgets
+	isAllowed, _ = limiter.allow("4.3.2.1", 3, now)
+	assert.True(isAllowed)
+
+	// one request comes back every 20 seconds
+	isAllowed, _ = limiter.allow("1.2.3.4", 3, now.Add(20*time.Second))
+	assert.True(isAllowed)
+	isAllowed, _ = limiter.allow("1.2.3.4", 3, now.Add(20*time.Second))
+	assert.False(isAllowed)
+
+	// the unused buckets are forgotten
+	limiter.allow("5.5.5.5", 3, now.Add(time.Hour))
+	assert.Len(limiter.buckets, 1)
+}
@@ -1,470 +1,195 @@
 package httpServer
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
 	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
 	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
 	"log"
-	"math/rand/v2"
+	"net"
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type webCaches struct {
-	indexHtml           string
-	inviteHtml          string
-	inviteNoSessionHtml string
-	userHtml            string
-}
-
-func loadCaches() (caches webCaches, err error) {
-	pageHtml, err := os.ReadFile("data/html/index.html")
-	if err != nil {
-		log.Fatal("Error while reading index.html: ", err)
-		return
-	}
-	caches.indexHtml = string(pageHtml)
-
-	pageHtml, err = os.ReadFile("data/html/invite.html")
-	if err != nil {
-		log.Fatal("Error while reading invite.html: ", err)
-		return
-	}
-	caches.inviteHtml = string(pageHtml)
-
-	pageHtml, err = os.ReadFile("data/html/invite_no_session.html")
-	if err != nil {
-		log.Fatal("Error while reading invite_no_session.html: ", err)
-		return
-	}
-	caches.inviteNoSessionHtml = string(pageHtml)
-
-	pageHtml, err = os.ReadFile("data/html/user.html")
-	if err != nil {
-		log.Fatal("Error while reading user.html: ", err)
-		return
-	}
-	caches.userHtml = string(pageHtml)
+const shutdownTimeout = 10 * time.Second
 
-	return
-}
-
-func servePreloaded(w http.ResponseWriter, page *string) {
-	_, err := fmt.Fprint(w, *page)
-	if err != nil {
-		log.Println("Error serving page: ", err)
-	}
+func homePage(w http.ResponseWriter, r *http.Request, staticData *processing.StaticProccessStructs, caches *webCaches) {
+	renderPage(w, r, caches.indexHtml, makeRequestPageData(w, r, staticData))
 }
 
-func homePage(w http.ResponseWriter, r *http.Request, caches *webCaches) {
-	servePreloaded(w, &caches.indexHtml)
-}
+func invitePage(w http.ResponseWriter, r *http.Request, staticData *processing.StaticProccessStructs, caches *webCaches) {
+	db := staticFunctions.GetDb(staticData)
+	trans := getRequestTrans(r, staticData)
 
-func invitePage(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, caches *webCaches) {
 	urlPayload := r.URL.Path[len("/invite/"):]
 	if urlPayload == "" {
-		http.Error(w, "Incorrect URL", http.StatusBadRequest)
+		http.Error(w, trans("web_error_incorrect_url"), http.StatusBadRequest)
 		return
 	}
 
 	urlPayloadSplit := strings.Split(urlPayload, "/")
 	if len(urlPayloadSplit) != 2 {
-		http.Error(w, "Incorrect URL format", http.StatusBadRequest)
+		http.Error(w, trans("web_error_url_format"), http.StatusBadRequest)
+		return
+	}
+
+	gameType := urlPayloadSplit[0]
+	if !slices.Contains(staticFunctions.InviteGameTypes, gameType) {
+		http.Error(w, trans("web_error_game_type"), http.StatusBadRequest)
 		return
 	}
 
 	gameToken := urlPayloadSplit[1]
 
+	data := makeRequestPageData(w, r, staticData)
+
 	_, isFound := db.GetSessionIdFromToken(gameToken)
 	if isFound {
-		servePreloaded(w, &caches.inviteHtml)
+		data.GameType = gameType
+		data.GameId = gameToken
+		data.TelegramLink = staticFunctions.GetTelegramInviteLink(staticData.BotName, data.GameType, gameToken)
+		renderPage(w, r, caches.inviteHtml, data)
 	} else {
-		servePreloaded(w, &caches.inviteNoSessionHtml)
+		renderPage(w, r, caches.inviteNoSessionHtml, data)
 	}
 }
 
-func joinGame(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
-	if r.Method != "POST" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	gameId := r.Form.Get("gameId")
-
-	if gameId == "" {
-		http.Error(w, "Incorrect game id, reload the page and try again", http.StatusBadRequest)
-		return
-	}
-
-	sessionId, isFound := db.GetSessionIdFromToken(gameId)
-	if !isFound {
-		http.Error(w, "Game not found. Was it ended?", http.StatusBadRequest)
-		return
-	}
-
-	token := int64(rand.Uint64() & 0x7FFFFFFFFFFFFFFF)
-
-	hasAdded := db.AddWebUser(sessionId, token)
-
-	if !hasAdded {
-		http.Error(w, "Can't add new user, try again", http.StatusBadRequest)
-		return
-	}
-
-	staticFunctions.UpdateSessionDialogs(sessionId, staticData)
-
-	stringToken := strconv.FormatInt(token, 10)
-
-	_, err = w.Write([]byte(stringToken))
-	if err != nil {
-		return
-	}
+// addWebUser adds a player that plays from the browser, the token is the only way to identify them
+func addWebUser(db *database.SpyBotDb, sessionId int64) (playerToken string, hasAdded bool) {
+	playerToken = database.GenerateToken(playerTokenBytes)
+	hasAdded = db.AddWebUser(sessionId, playerToken)
+	return
 }
 
-func gamePage(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, caches *webCaches) {
+func gamePage(w http.ResponseWriter, r *http.Request, staticData *processing.StaticProccessStructs, caches *webCaches) {
+	db := staticFunctions.GetDb(staticData)
+	trans := getRequestTrans(r, staticData)
+
 	if r.Method != "GET" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		http.Error(w, trans("web_error_method"), http.StatusMethodNotAllowed)
 		return
 	}
 
-	// get player token from URL
+	// the URL has only the game type, the player is identified by the cookie
 	urlPayload := r.URL.Path[len("/user/"):]
 	if urlPayload == "" {
-		http.Error(w, "Incorrect URL", http.StatusBadRequest)
+		http.Error(w, trans("web_error_incorrect_url"), http.StatusBadRequest)
 		return
 	}
 
 	urlPayloadSplit := strings.Split(urlPayload, "/")
-	if len(urlPayloadSplit) != 2 {
-		http.Error(w, "Incorrect URL format", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := urlPayloadSplit[1]
-
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	_, isFound := db.GetWebUserId(playerToken)
-	if isFound {
-		servePreloaded(w, &caches.userHtml)
-	} else {
-		servePreloaded(w, &caches.inviteNoSessionHtml)
-	}
-}
-
-func getLastMessages(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb) {
-	if r.Method != "GET" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := r.Form.Get("playerToken")
-	if playerTokenStr == "" {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
+	if len(urlPayloadSplit) > 1 {
+		// the links from the older versions had the token in the path, it shouldn't stay in the history
+		http.Redirect(w, r, "/user/"+urlPayloadSplit[0], http.StatusSeeOther)
 		return
 	}
 
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
+	playerToken := getPlayerTokenCookie(r)
+	if !isPlayerTokenCorrect(playerToken) {
+		renderPage(w, r, caches.inviteNoSessionHtml, makeRequestPageData(w, r, staticData))
 		return
 	}
 
 	userId, isFound := db.GetWebUserId(playerToken)
 	if !isFound {
-		http.Error(w, "Player not found, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	lastMessageIdxStr := r.Form.Get("lastMessageIdx")
-	if lastMessageIdxStr == "" {
-		http.Error(w, "Incorrect last message index", http.StatusBadRequest)
-		return
-	}
-
-	lastMessageIdx, err := strconv.Atoi(lastMessageIdxStr)
-	if err != nil {
-		http.Error(w, "Incorrect last message index", http.StatusBadRequest)
+		renderPage(w, r, caches.inviteNoSessionHtml, makeRequestPageData(w, r, staticData))
 		return
 	}
 
 	sessionId, isInSession := db.GetUserSession(userId)
 	if !isInSession {
-		http.Error(w, "Player not in session, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	messages, newLastIdx := db.GetNewRecentWebMessages(userId, lastMessageIdx)
-
-	w.Header().Set("Content-Type", "application/json")
-	messagesStr := ""
-	for i, message := range messages {
-		if i > 0 {
-			messagesStr += ","
-		}
-
-		sanitizedString := strings.Replace(message, "\n", "<br/>", -1)
-		sanitizedString = strings.Replace(sanitizedString, "\"", "\\\"", -1)
-
-		messagesStr += "\"" + sanitizedString + "\""
-	}
-
-	playersCount := db.GetUsersCountInSession(sessionId, false)
-
-	_, err = w.Write([]byte("{\"lastMessageIdx\":" + strconv.Itoa(newLastIdx) + ",\"players\":" + strconv.FormatInt(playersCount, 10) + ",\"messages\":[" + messagesStr + "]}"))
-}
-
-func sendHiddenMessage(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
-	if r.Method != "POST" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := r.Form.Get("playerToken")
-	if playerTokenStr == "" {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
+		renderPage(w, r, caches.inviteNoSessionHtml, makeRequestPageData(w, r, staticData))
 		return
 	}
 
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	userId, isFound := db.GetWebUserId(playerToken)
+	// the page is in the same language as the game messages, it is changed from the page itself
+	config, _ := staticFunctions.GetConfig(staticData)
+	langKey, isFound := staticFunctions.FindAvailableLanguage(&config, db.GetUserLanguage(userId))
 	if !isFound {
-		http.Error(w, "Player not found, has the game ended?", http.StatusNotFound)
-		return
+		langKey, _ = findRequestLanguage(r, &config)
 	}
 
-	sessionId, isInSession := db.GetUserSession(userId)
-	if !isInSession {
-		http.Error(w, "Player not in session, has the game ended?", http.StatusNotFound)
-		return
-	}
+	data := makePageData(staticData, langKey)
+	data.GameType = urlPayloadSplit[0]
+	data.PlayersCount = db.GetUsersCountInSession(sessionId, false)
+	renderPage(w, r, caches.userHtml, data)
+}
 
-	message := r.Form.Get("message")
-	if message == "" {
-		http.Error(w, "The message is empty", http.StatusBadRequest)
-		return
-	}
+// MakeHandler creates a mux with all the pages of the web client and the API it uses
+func MakeHandler(htmlCache *HtmlCache, staticData *processing.StaticProccessStructs) *http.ServeMux {
+	db := staticFunctions.GetDb(staticData)
+	limits := makeApiLimits(staticData)
 
-	isSucceeded := staticFunctions.SendThemeToOthers(staticData, sessionId, userId, message)
+	mux := http.NewServeMux()
 
-	if !isSucceeded {
-		_, err = w.Write([]byte("Not enough players"))
-		if err != nil {
-			return
-		}
-	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		homePage(w, r, staticData, htmlCache.get())
+	})
+	mux.HandleFunc("/invite/", func(w http.ResponseWriter, r *http.Request) {
+		invitePage(w, r, staticData, htmlCache.get())
+	})
+	mux.HandleFunc("/user/", func(w http.ResponseWriter, r *http.Request) {
+		gamePage(w, r, staticData, htmlCache.get())
+	})
+	// encoding the images takes more time than the other pages, so they count for the limit of the API
+	mux.Handle(qrCodePrefix, limits.limitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		qrCodeImage(w, r, db, staticData)
+	})))
+	registerApiHandlers(mux, db, staticData, limits)
 
-	_, err = w.Write([]byte("ok"))
-	if err != nil {
-		return
-	}
+	return mux
 }
 
-func sendSpyfallLocation(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
-	if r.Method != "POST" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := r.Form.Get("playerToken")
-	if playerTokenStr == "" {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
+// HandleHttpRequests serves until the context is canceled, then lets the active requests finish
+func HandleHttpRequests(ctx context.Context, config *static.StaticConfiguration, handler http.Handler) error {
+	proxies, err := parseTrustedProxies(config.TrustedProxies)
 	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
+		return err
 	}
 
-	userId, isFound := db.GetWebUserId(playerToken)
-	if !isFound {
-		http.Error(w, "Player not found, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	sessionId, isInSession := db.GetUserSession(userId)
-	if !isInSession {
-		http.Error(w, "Player not in session, has the game ended?", http.StatusNotFound)
-		return
+	server := &http.Server{
+		Addr:    net.JoinHostPort(config.HttpBindAddress, strconv.Itoa(config.HttpServerPort)),
+		Handler: handleForwardedHeaders(proxies, handler),
 	}
 
-	isSucceeded := staticFunctions.SendSpyfallLocationToAll(staticData, sessionId)
-
-	if !isSucceeded {
-		_, err = w.Write([]byte("Not enough players"))
+	isTlsEnabled := config.TlsCertFile != ""
+	if isTlsEnabled {
+		certificates, err := makeCertificateLoader(config.TlsCertFile, config.TlsKeyFile)
 		if err != nil {
-			return
+			return err
+		}
+		server.TLSConfig = &tls.Config{
+			GetCertificate: certificates.getCertificate,
+			MinVersion:     tls.VersionTLS12,
 		}
 	}
 
-	_, err = w.Write([]byte("ok"))
-}
-
-func leaveGame(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
-	if r.Method != "POST" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := r.Form.Get("playerToken")
-	if playerTokenStr == "" {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	userId, isFound := db.GetWebUserId(playerToken)
-	if !isFound {
-		http.Error(w, "Player not found, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	sessionId, isInSession := db.GetUserSession(userId)
-	if !isInSession {
-		http.Error(w, "Player not in session, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	db.RemoveWebUser(playerToken)
-
-	staticFunctions.UpdateSessionDialogs(sessionId, staticData)
-
-	_, err = w.Write([]byte("ok"))
-}
-
-func sendNumbers(w http.ResponseWriter, r *http.Request, db *database.SpyBotDb, staticData *processing.StaticProccessStructs) {
-	if r.Method != "POST" {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Can't parse form", http.StatusBadRequest)
-		return
-	}
-
-	playerTokenStr := r.Form.Get("playerToken")
-	if playerTokenStr == "" {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	playerToken, err := strconv.ParseInt(playerTokenStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Incorrect player token", http.StatusBadRequest)
-		return
-	}
-
-	userId, isFound := db.GetWebUserId(playerToken)
-	if !isFound {
-		http.Error(w, "Player not found, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	sessionId, isInSession := db.GetUserSession(userId)
-	if !isInSession {
-		http.Error(w, "Player not in session, has the game ended?", http.StatusNotFound)
-		return
-	}
-
-	staticFunctions.GiveRandomNumbersToPlayers(staticData, sessionId)
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- server.Shutdown(shutdownCtx)
+	}()
 
-	_, err = w.Write([]byte("ok"))
-	if err != nil {
-		return
+	if isTlsEnabled {
+		// the certificate is provided by TLSConfig
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
 	}
-}
-
-func HandleHttpRequests(port int, staticData *processing.StaticProccessStructs) {
-	db := staticFunctions.GetDb(staticData)
-
-	caches, err := loadCaches()
-	if err != nil {
-		return
+	if err != http.ErrServerClosed {
+		return err
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		homePage(w, r, &caches)
-	})
-	http.HandleFunc("/invite/", func(w http.ResponseWriter, r *http.Request) {
-		invitePage(w, r, db, &caches)
-	})
-	http.HandleFunc("/join", func(w http.ResponseWriter, r *http.Request) {
-		joinGame(w, r, db, staticData)
-	})
-	http.HandleFunc("/user/", func(w http.ResponseWriter, r *http.Request) {
-		gamePage(w, r, db, &caches)
-	})
-	http.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
-		getLastMessages(w, r, db)
-	})
-	http.HandleFunc("/send", func(w http.ResponseWriter, r *http.Request) {
-		sendHiddenMessage(w, r, db, staticData)
-	})
-	http.HandleFunc("/spyfall", func(w http.ResponseWriter, r *http.Request) {
-		sendSpyfallLocation(w, r, db, staticData)
-	})
-	http.HandleFunc("/leave", func(w http.ResponseWriter, r *http.Request) {
-		leaveGame(w, r, db, staticData)
-	})
-	http.HandleFunc("/numbers", func(w http.ResponseWriter, r *http.Request) {
-		sendNumbers(w, r, db, staticData)
-	})
-
-	addr := ":" + strconv.Itoa(port)
-	err = http.ListenAndServe(addr, nil)
-	if err != nil {
-		log.Fatal(err)
+	err = <-shutdownErr
+	if err == nil {
+		log.Print("HTTP server stopped")
 	}
+	return err
 }
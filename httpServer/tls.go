@@ -0,0 +1,100 @@
+package httpServer
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// the files are not checked on every handshake, renewed certificates are picked up within this time
+const certificateCheckInterval = time.Minute
+
+// certificateLoader serves the certificate from the files and loads it again when the files change,
+// e.g. after a renewal by certbot
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+func getModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func makeCertificateLoader(certFile string, keyFile string) (loader *certificateLoader, err error) {
+	loader = &certificateLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	err = loader.load(time.Now())
+	return
+}
+
+func (loader *certificateLoader) load(now time.Time) error {
+	certModTime, err := getModTime(loader.certFile)
+	if err != nil {
+		return err
+	}
+	keyModTime, err := getModTime(loader.keyFile)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(loader.certFile, loader.keyFile)
+	if err != nil {
+		return err
+	}
+
+	loader.certificate = &certificate
+	loader.certModTime = certModTime
+	loader.keyModTime = keyModTime
+	loader.lastCheck = now
+	return nil
+}
+
+// reloadIfChanged keeps the previous certificate if the new files can't be loaded,
+// the certificate and the key can be written not at the same time
+func (loader *certificateLoader) reloadIfChanged(now time.Time) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	if now.Sub(loader.lastCheck) < certificateCheckInterval {
+		return
+	}
+	loader.lastCheck = now
+
+	certModTime, certErr := getModTime(loader.certFile)
+	keyModTime, keyErr := getModTime(loader.keyFile)
+	if certErr != nil || keyErr != nil {
+		return
+	}
+	if certModTime.Equal(loader.certModTime) && keyModTime.Equal(loader.keyModTime) {
+		return
+	}
+
+	err := loader.load(now)
+	if err != nil {
+		log.Printf("Can't reload TLS certificate, keeping the previous one: %s", err.Error())
+		return
+	}
+	log.Print("TLS certificate reloaded")
+}
+
+func (loader *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	loader.reloadIfChanged(time.Now())
+
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	return loader.certificate, nil
+}
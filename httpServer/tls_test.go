@@ -0,0 +1,76 @@
+package httpServer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, certFile string, keyFile string, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func getCertificateName(t *testing.T, loader *certificateLoader) string {
+	certificate, err := loader.getCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	startTime := time.Now().Add(-time.Hour)
+
+	writeTestCertificate(t, certFile, keyFile, "first", startTime)
+	loader, err := makeCertificateLoader(certFile, keyFile)
+	assert.NoError(err)
+	assert.Equal("first", getCertificateName(t, loader))
+
+	writeTestCertificate(t, certFile, keyFile, "second", startTime.Add(time.Minute))
+
+	// the files are not checked too often
+	loader.reloadIfChanged(loader.lastCheck.Add(time.Second))
+	assert.Equal("first", getCertificateName(t, loader))
+
+	loader.lastCheck = time.Now().Add(-2 * certificateCheckInterval)
+	assert.Equal("second", getCertificateName(t, loader))
+
+	// a broken renewal doesn't break the server
+	assert.NoError(os.WriteFile(certFile, []byte("not a certificate"), 0600))
+	loader.lastCheck = time.Now().Add(-2 * certificateCheckInterval)
+	assert.Equal("second", getCertificateName(t, loader))
+
+	_, err = makeCertificateLoader(certFile, keyFile)
+	assert.Error(err)
+}
@@ -0,0 +1,50 @@
+package httpServer
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"log"
+	"net/http"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// Telegram sends updates one by one, bigger requests are not updates
+	maxWebhookRequestSize = 1 << 20
+)
+
+// MakeWebhookHandler accepts updates that Telegram sends to the webhook and passes them to the updates channel,
+// requests without the correct secret token are rejected
+func MakeWebhookHandler(ctx context.Context, secretToken string, updates chan<- tgbotapi.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(secretToken)) != 1 {
+			log.Printf("Webhook request with a wrong secret token from %s", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookRequestSize)).Decode(&update)
+		if err != nil {
+			log.Printf("Can't parse webhook update: %s", err.Error())
+			http.Error(w, "Can't parse update", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-ctx.Done():
+			// Telegram will send the update again after the restart
+			http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}
+}
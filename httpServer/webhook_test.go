@@ -0,0 +1,65 @@
+package httpServer
+
+import (
+	"context"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testUpdateJson = `{"update_id": 1, "message": {"message_id": 2, "from": {"id": 3, "first_name": "Test", "language_code": "en"}, "chat": {"id": 3, "type": "private"}, "date": 0, "text": "/start"}}`
+
+func postTestUpdate(handler http.Handler, secretToken string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	if secretToken != "" {
+		request.Header.Set(secretTokenHeader, secretToken)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestWebhookPassesUpdates(t *testing.T) {
+	assert := require.New(t)
+
+	updates := make(chan tgbotapi.Update, 1)
+	handler := MakeWebhookHandler(context.Background(), "secret", updates)
+
+	response := postTestUpdate(handler, "secret", testUpdateJson)
+	assert.Equal(http.StatusOK, response.Code)
+
+	update := <-updates
+	assert.Equal(1, update.UpdateID)
+	assert.Equal("/start", update.Message.Text)
+	assert.Equal(int64(3), update.Message.Chat.ID)
+}
+
+func TestWebhookRejectsWrongRequests(t *testing.T) {
+	assert := require.New(t)
+
+	updates := make(chan tgbotapi.Update, 1)
+	handler := MakeWebhookHandler(context.Background(), "secret", updates)
+
+	assert.Equal(http.StatusForbidden, postTestUpdate(handler, "", testUpdateJson).Code)
+	assert.Equal(http.StatusForbidden, postTestUpdate(handler, "wrong", testUpdateJson).Code)
+	assert.Equal(http.StatusBadRequest, postTestUpdate(handler, "secret", "{not json").Code)
+
+	request := httptest.NewRequest(http.MethodGet, "/webhook", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code)
+
+	assert.Empty(updates)
+}
+
+func TestWebhookDuringShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads the updates anymore
+	handler := MakeWebhookHandler(ctx, "secret", make(chan tgbotapi.Update))
+	require.Equal(t, http.StatusServiceUnavailable, postTestUpdate(handler, "secret", testUpdateJson).Code)
+}
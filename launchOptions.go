@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const envPrefix = "SPY_BOT_"
+
+type launchOptions struct {
+	// the token itself takes precedence over the token file, unless the file is set with a flag
+	apiToken     string
+	apiTokenPath string
+	configPath   string
+	dbPath       string
+	stringsDir   string
+	htmlDir      string
+	// only report configuration problems and exit
+	checkConfig bool
+	// run with fake users from the standard input instead of Telegram
+	simulate bool
+	// maintenance subcommand with its arguments
+	commandArgs []string
+}
+
+type launchOption struct {
+	value        *string
+	flagName     string
+	envName      string
+	defaultValue string
+	usage        string
+}
+
+func makeLaunchOptionsList(options *launchOptions) []launchOption {
+	return []launchOption{
+		{&options.apiToken, "token", "TOKEN", "", "Telegram API token, prefer the environment variable to not expose it in the process list"},
+		{&options.apiTokenPath, "token-file", "TOKEN_FILE", "./telegramApiToken.txt", "file containing Telegram API token, used only if the token is not set directly, the flag overrides the token from the environment"},
+		{&options.configPath, "config", "CONFIG", "./config.json", "path to the configuration file"},
+		{&options.dbPath, "db", "DB", "./bot-data.db", "path to the SQLite database"},
+		{&options.stringsDir, "strings-dir", "STRINGS_DIR", "./data/strings", "directory with the translation files"},
+		{&options.htmlDir, "html-dir", "HTML_DIR", "", "directory with the web pages to use instead of the built-in ones, they are reloaded on every request"},
+	}
+}
+
+// parseLaunchOptions reads the options with this precedence: command-line flag, environment variable, default value
+func parseLaunchOptions(args []string, getEnv func(string) string, output io.Writer) (options launchOptions, err error) {
+	flagSet := flag.NewFlagSet("telegram-spy-game-bot", flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	flagSet.Usage = func() {
+		fmt.Fprintln(output, "Usage: telegram-spy-game-bot [flags] [backup|export|import <file>]")
+		fmt.Fprintln(output, "Every flag can also be set with an environment variable, flags take precedence.")
+		flagSet.PrintDefaults()
+	}
+
+	optionsList := makeLaunchOptionsList(&options)
+	flagValues := make([]string, len(optionsList))
+	for i, option := range optionsList {
+		envName := envPrefix + option.envName
+		flagSet.StringVar(&flagValues[i], option.flagName, "", fmt.Sprintf("%s (env %s, default \"%s\")", option.usage, envName, option.defaultValue))
+	}
+
+	flagSet.BoolVar(&options.checkConfig, "check-config", false, "report all problems in the configuration and translations and exit")
+	flagSet.BoolVar(&options.simulate, "simulate", false, "run without Telegram, read the actions of fake users from the standard input and print the bot messages")
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		return
+	}
+
+	setFlags := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	for i, option := range optionsList {
+		if setFlags[option.flagName] {
+			*option.value = flagValues[i]
+		} else if envValue, isSet := lookupEnv(getEnv, envPrefix+option.envName); isSet {
+			*option.value = envValue
+		} else {
+			*option.value = option.defaultValue
+		}
+	}
+
+	// the token from the environment would be used instead of the file given on the command line
+	if setFlags["token-file"] && !setFlags["token"] {
+		options.apiToken = ""
+	}
+
+	options.commandArgs = flagSet.Args()
+
+	err = validateLaunchOptions(&options, setFlags)
+	return
+}
+
+func lookupEnv(getEnv func(string) string, name string) (value string, isSet bool) {
+	value = strings.TrimSpace(getEnv(name))
+	return value, value != ""
+}
+
+func validateLaunchOptions(options *launchOptions, setFlags map[string]bool) error {
+	var problems []string
+
+	if setFlags["token"] && setFlags["token-file"] {
+		problems = append(problems, "-token and -token-file can't be used together")
+	}
+
+	// maintenance commands don't talk to Telegram and don't need the rest of the files
+	if len(options.commandArgs) == 0 {
+		if options.apiToken == "" && !options.checkConfig && !options.simulate {
+			if _, err := os.Stat(options.apiTokenPath); err != nil {
+				problems = append(problems, fmt.Sprintf("no API token: set %sTOKEN or provide a token file (%s)", envPrefix, err.Error()))
+			}
+		}
+
+		if _, err := os.Stat(options.configPath); err != nil {
+			problems = append(problems, fmt.Sprintf("config file: %s", err.Error()))
+		}
+
+		if info, err := os.Stat(options.stringsDir); err != nil {
+			problems = append(problems, fmt.Sprintf("translations directory: %s", err.Error()))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("translations directory: %s is not a directory", options.stringsDir))
+		}
+	}
+
+	if info, err := os.Stat(filepath.Dir(options.dbPath)); err != nil {
+		problems = append(problems, fmt.Sprintf("database directory: %s", err.Error()))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("database directory: %s is not a directory", filepath.Dir(options.dbPath)))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
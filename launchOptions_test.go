@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(path string, content string) error {
+	return os.WriteFile(path, []byte(content), 0600)
+}
+
+func makeTestInstallDir(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, writeTestFile(filepath.Join(dir, "config.json"), "{}"))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "strings"), 0700))
+	return dir
+}
+
+func TestLaunchOptionsPrecedence(t *testing.T) {
+	assert := require.New(t)
+	dir := makeTestInstallDir(t)
+
+	env := map[string]string{
+		"SPY_BOT_TOKEN":       "env-token",
+		"SPY_BOT_CONFIG":      filepath.Join(dir, "config.json"),
+		"SPY_BOT_STRINGS_DIR": filepath.Join(dir, "strings"),
+		"SPY_BOT_DB":          filepath.Join(dir, "env.db"),
+	}
+
+	options, err := parseLaunchOptions([]string{"-db", filepath.Join(dir, "flag.db")}, func(name string) string { return env[name] }, io.Discard)
+	assert.NoError(err)
+
+	// flags override environment
+	assert.Equal(filepath.Join(dir, "flag.db"), options.dbPath)
+	// environment overrides defaults
+	assert.Equal("env-token", options.apiToken)
+	assert.Equal(filepath.Join(dir, "config.json"), options.configPath)
+	// defaults are used when nothing is set
+	assert.Equal("", options.htmlDir)
+	assert.Equal(0, len(options.commandArgs))
+
+	// the token file from the flags overrides the token from the environment
+	tokenPath := filepath.Join(dir, "token.txt")
+	assert.NoError(writeTestFile(tokenPath, "file-token"))
+	options, err = parseLaunchOptions([]string{"-token-file", tokenPath}, func(name string) string { return env[name] }, io.Discard)
+	assert.NoError(err)
+	assert.Equal("", options.apiToken)
+	token, err := getApiToken(&options)
+	assert.NoError(err)
+	assert.Equal("file-token", token)
+}
+
+func TestLaunchOptionsValidation(t *testing.T) {
+	assert := require.New(t)
+	dir := makeTestInstallDir(t)
+	noEnv := func(string) string { return "" }
+
+	{
+		_, err := parseLaunchOptions([]string{"-token", "a", "-token-file", "b"}, noEnv, io.Discard)
+		assert.ErrorContains(err, "can't be used together")
+	}
+
+	{
+		_, err := parseLaunchOptions([]string{"-config", filepath.Join(dir, "missing.json"), "-token", "a", "-strings-dir", filepath.Join(dir, "strings")}, noEnv, io.Discard)
+		assert.ErrorContains(err, "config file")
+	}
+
+	{
+		// maintenance commands need only the database
+		options, err := parseLaunchOptions([]string{"-db", filepath.Join(dir, "bot.db"), "backup", "copy.db"}, noEnv, io.Discard)
+		assert.NoError(err)
+		assert.Equal([]string{"backup", "copy.db"}, options.commandArgs)
+	}
+
+	{
+		_, err := parseLaunchOptions([]string{"-db", filepath.Join(dir, "missing", "bot.db"), "backup", "copy.db"}, noEnv, io.Discard)
+		assert.ErrorContains(err, "database directory")
+	}
+}
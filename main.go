@@ -1,23 +1,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialogManager"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	"github.com/gameraccoon/telegram-bot-skeleton/telegramChat"
 	"github.com/gameraccoon/telegram-spy-game-bot/database"
 	"github.com/gameraccoon/telegram-spy-game-bot/dialogFactories"
 	"github.com/gameraccoon/telegram-spy-game-bot/httpServer"
 	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
+	"github.com/gameraccoon/telegram-spy-game-bot/webEvents"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/nicksnyder/go-i18n/i18n"
 	"io/ioutil"
 	"log"
-	"math/rand"
+	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
+	"syscall"
 )
 
+const simulatorBotUsername = "spy_game_simulator_bot"
+
 func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 }
@@ -30,95 +42,212 @@ func getFileStringContent(filePath string) (content string, err error) {
 	return
 }
 
-func getApiToken() (token string, err error) {
-	return getFileStringContent("./telegramApiToken.txt")
+func getApiToken(options *launchOptions) (token string, err error) {
+	if options.apiToken != "" {
+		return options.apiToken, nil
+	}
+	return getFileStringContent(options.apiTokenPath)
 }
 
 func loadConfig(path string) (config static.StaticConfiguration, err error) {
 	jsonString, err := getFileStringContent(path)
 	if err == nil {
 		dec := json.NewDecoder(strings.NewReader(jsonString))
+		// a typo in a key would silently leave a zero value otherwise
+		dec.DisallowUnknownFields()
 		err = dec.Decode(&config)
 	}
 	return
 }
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
+func makeDialogManager() *dialogManager.DialogManager {
+	dialogManager := &(dialogManager.DialogManager{})
+	dialogManager.RegisterDialogFactory("us", dialogFactories.MakeUserSettingsDialogFactory())
+	dialogManager.RegisterDialogFactory("lc", dialogFactories.MakeLanguageSelectDialogFactory())
+	dialogManager.RegisterDialogFactory("se", dialogFactories.MakeSessionDialogFactory())
+	dialogManager.RegisterDialogFactory("ns", dialogFactories.MakeNoSessionDialogFactory())
+	dialogManager.RegisterDialogFactory("in", dialogFactories.MakeInviteDialogFactory())
+	dialogManager.RegisterDialogFactory("gr", dialogFactories.MakeGroupDialogFactory())
+	dialogManager.RegisterTextInputProcessorManager(dialogFactories.GetTextInputProcessorManager())
+	return dialogManager
+}
 
-	apiToken, err := getApiToken()
-	if err != nil {
-		log.Fatal(err.Error())
+func makeStaticData(botTransport transport.Transport, db *database.SpyBotDb, configStorage *static.ConfigStorage, dialogManager *dialogManager.DialogManager) *processing.StaticProccessStructs {
+	staticData := &processing.StaticProccessStructs{
+		Chat: botTransport,
+		Db:   db,
+		// the translators are stored together with the config to be reloaded at once
+		Config: configStorage,
+		MakeDialogFn: func(id string, userId int64, trans i18n.TranslateFunc, staticData *processing.StaticProccessStructs, customData interface{}) *dialog.Dialog {
+			return dialogManager.MakeDialog(id, userId, trans, staticData, customData)
+		},
+		BotName: botTransport.GetBotUsername(),
 	}
 
-	config, err := loadConfig("./config.json")
+	staticData.Init()
+	staticFunctions.SetWebEventsBroker(staticData, webEvents.MakeBroker())
+	staticData.SetCustomValue(workerStatsKey, &workerStats{})
+	staticData.SetCustomValue(adminJobsKey, makeAdminJobs())
+	return staticData
+}
+
+func main() {
+	options, err := parseLaunchOptions(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal(err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
 	}
 
-	translators := make(map[string]i18n.TranslateFunc)
+	if len(options.commandArgs) > 0 {
+		os.Exit(runCommandLineTool(options.commandArgs, &options))
+	}
 
-	for _, lang := range config.AvailableLanguages {
-		i18n.MustLoadTranslationFile("./data/strings/" + lang.Key + ".all.json")
+	config, translators, problems := loadAndValidateConfig(&options)
 
-		trans, err1 := i18n.Tfunc(lang.Key)
-		if err1 != nil {
-			log.Fatal(err.Error())
+	if options.checkConfig {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "Found %d problems in the configuration\n", len(problems))
+			os.Exit(1)
 		}
-		translators[lang.Key] = trans
+		fmt.Println("Configuration is valid")
+		return
 	}
 
-	if len(translators) <= 0 {
-		log.Fatal("Need at least one language available")
+	if len(problems) > 0 {
+		log.Fatalf("Configuration has problems, run with -check-config to list them:\n%s", strings.Join(problems, "\n"))
 	}
 
-	if _, ok := translators[config.DefaultLanguage]; !ok {
-		log.Fatal("Default language should be in the list of available languages")
+	var apiToken string
+	if !options.simulate {
+		apiToken, err = getApiToken(&options)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 	}
 
-	db, err := database.ConnectDb("./bot-data.db")
-	defer db.Disconnect()
-
+	db, err := database.ConnectDb(options.dbPath)
 	if err != nil {
 		log.Fatal("Can't connect database")
 	}
 
 	database.UpdateVersion(db)
 
-	chat, err := telegramChat.MakeTelegramChat(apiToken)
-	if err != nil {
-		log.Fatal(err.Error())
+	var botTransport transport.Transport
+	var telegramTransport *transport.TelegramTransport
+	if options.simulate {
+		fmt.Println(transport.SimulatorHelp)
+		botTransport = transport.MakeSimulator(os.Stdin, os.Stdout, simulatorBotUsername)
+	} else {
+		telegramTransport, err = transport.MakeTelegramTransport(apiToken)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("Authorized on account %s", telegramTransport.GetBotUsername())
+
+		telegramTransport.SetDebugModeEnabled(config.ExtendedLog)
+		botTransport = telegramTransport
 	}
 
-	log.Printf("Authorized on account %s", chat.GetBotUsername())
+	dialogManager := makeDialogManager()
 
-	chat.SetDebugModeEnabled(config.ExtendedLog)
+	configStorage := static.MakeConfigStorage(config, translators)
 
-	dialogManager := &(dialogManager.DialogManager{})
-	dialogManager.RegisterDialogFactory("us", dialogFactories.MakeUserSettingsDialogFactory())
-	dialogManager.RegisterDialogFactory("lc", dialogFactories.MakeLanguageSelectDialogFactory())
-	dialogManager.RegisterDialogFactory("se", dialogFactories.MakeSessionDialogFactory())
-	dialogManager.RegisterDialogFactory("ns", dialogFactories.MakeNoSessionDialogFactory())
-	dialogManager.RegisterDialogFactory("in", dialogFactories.MakeInviteDialogFactory())
-	dialogManager.RegisterTextInputProcessorManager(dialogFactories.GetTextInputProcessorManager())
+	staticData := makeStaticData(botTransport, db, configStorage, dialogManager)
 
-	staticData := &processing.StaticProccessStructs{
-		Chat:   chat,
-		Db:     db,
-		Config: config,
-		Trans:  translators,
-		MakeDialogFn: func(id string, userId int64, trans i18n.TranslateFunc, staticData *processing.StaticProccessStructs, customData interface{}) *dialog.Dialog {
-			return dialogManager.MakeDialog(id, userId, trans, staticData, customData)
-		},
-		BotName: chat.GetBotUsername(),
+	configReloader := &reloader{
+		options: &options,
+		storage: configStorage,
 	}
+	staticData.SetCustomValue(reloaderKey, configReloader)
 
-	staticData.Init()
+	if telegramTransport != nil {
+		publishBotCommands(telegramTransport, &config, translators)
+		configReloader.publishCommands = func(config *static.StaticConfiguration, translators map[string]i18n.TranslateFunc) {
+			publishBotCommands(telegramTransport, config, translators)
+		}
+	}
+
+	// stop gracefully on Ctrl+C and on termination from the service manager
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var backgroundTasks sync.WaitGroup
+	// set by the background tasks too
+	var exitCode atomic.Int32
+
+	// the open event streams would delay the shutdown of the HTTP server
+	context.AfterFunc(ctx, staticFunctions.GetWebEventsBroker(staticData).Stop)
+	context.AfterFunc(ctx, getAdminJobs(staticData).stop)
+
+	var webhookUpdates chan tgbotapi.Update
 
 	if config.RunHttpServer {
+		htmlCache, err := httpServer.LoadHtmlCache(options.htmlDir)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		configReloader.htmlCache = htmlCache
+
+		handler := httpServer.MakeHandler(htmlCache, staticData)
+		if config.UseWebhook && telegramTransport != nil {
+			webhookUpdates = make(chan tgbotapi.Update)
+			handler.Handle(getWebhookPath(&config), httpServer.MakeWebhookHandler(ctx, config.WebhookSecretToken, webhookUpdates))
+		}
+
 		log.Println("Starting HTTP server")
-		go httpServer.HandleHttpRequests(config.HttpServerPort, staticData)
+		backgroundTasks.Add(1)
+		go func() {
+			defer backgroundTasks.Done()
+			err := httpServer.HandleHttpRequests(ctx, &config, handler)
+			if err != nil {
+				log.Printf("HTTP server failed: %s", err.Error())
+				// the bot can't work properly without the web part, shut down everything
+				exitCode.Store(1)
+				stop()
+			}
+		}()
+	}
+
+	go reloadOnSignal(configReloader)
+
+	if staticFunctions.IsSessionCleanupEnabled(&config) {
+		log.Println("Starting session cleanup")
+		backgroundTasks.Add(1)
+		go func() {
+			defer backgroundTasks.Done()
+			staticFunctions.RunSessionCleanup(ctx, staticData)
+		}()
+	}
+
+	if webhookUpdates != nil {
+		err = telegramTransport.SetWebhook(config.WebhookUrl, config.WebhookSecretToken, webhookUpdates)
+		if err != nil {
+			log.Printf("Can't set webhook: %s", err.Error())
+			// the bot would get no updates, the HTTP server and the other tasks are already running and should stop gracefully
+			exitCode.Store(1)
+			stop()
+		} else {
+			log.Printf("Receiving updates from webhook %s", config.WebhookUrl)
+		}
+	}
+
+	if ctx.Err() == nil {
+		startUpdating(ctx, botTransport, dialogManager, staticData)
 	}
 
-	startUpdating(chat, dialogManager, staticData)
+	// the transport can run out of updates before the shutdown was requested
+	stop()
+
+	backgroundTasks.Wait()
+	getAdminJobs(staticData).wait()
+	db.Disconnect()
+	log.Print("Shut down")
+	os.Exit(int(exitCode.Load()))
 }
@@ -13,12 +13,26 @@ type ProcessorFuncMap map[string]ProcessorFunc
 
 func startCommand(data *processing.ProcessData) {
 	if len(data.Message) > 0 {
-		isSuccessful := staticFunctions.ConnectToSession(data, data.Message)
-		if isSuccessful {
-			return
-		}
+		gameType, sessionToken, isValid := staticFunctions.ParseStartPayload(data.Message)
+		if !isValid {
+			data.SendMessage(data.Trans("link_malformed"), true)
+		} else {
+			isSuccessful, isSessionFull := staticFunctions.ConnectToSession(data, sessionToken)
+			if isSuccessful {
+				if gameType != "" {
+					data.SendMessage(data.Trans("link_joined_game", map[string]interface{}{
+						"Game": data.Trans(staticFunctions.GetGameNameTextId(gameType)),
+					}), true)
+				}
+				return
+			}
 
-		data.SendMessage(data.Trans("link_session_is_old"), true)
+			if isSessionFull {
+				data.SendMessage(data.Trans("session_is_full"), true)
+			} else {
+				data.SendMessage(data.Trans("link_session_ended"), true)
+			}
+		}
 	} else {
 		data.SendMessage(data.Trans("start_message"), true)
 	}
@@ -89,6 +103,38 @@ func makeUserCommandProcessors() ProcessorFuncMap {
 	}
 }
 
+func newGameCommand(data *processing.ProcessData) {
+	// the public messages are in the language of the player who started the game
+	var langKey string
+	if data.UserId != 0 {
+		langKey = staticFunctions.GetUserLanguageOrDefault(data.Static, data.UserId)
+	} else {
+		// the users who never started the bot have only the language of their Telegram app
+		config, _ := staticFunctions.GetConfig(data.Static)
+		langKey, _ = staticFunctions.FindAvailableLanguage(&config, data.UserSystemLang)
+		if langKey == "" {
+			langKey = config.DefaultLanguage
+		}
+	}
+	staticFunctions.CreateGroupSession(data.Static, data.ChatId, langKey)
+}
+
+// makeGroupCommandProcessors returns the commands that can be sent in group chats
+func makeGroupCommandProcessors() ProcessorFuncMap {
+	return map[string]ProcessorFunc{
+		"newgame": newGameCommand,
+	}
+}
+
+// makeCommandProcessors returns user commands together with the commands available only for admins
+func makeCommandProcessors() ProcessorFuncMap {
+	processors := makeUserCommandProcessors()
+	for command, processor := range makeAdminCommandProcessors() {
+		processors[command] = adminOnly(processor)
+	}
+	return processors
+}
+
 func processCommandByProcessors(data *processing.ProcessData, processors *ProcessorFuncMap) bool {
 	processor, ok := (*processors)[data.Command]
 	if ok {
@@ -99,7 +145,9 @@ func processCommandByProcessors(data *processing.ProcessData, processors *Proces
 }
 
 func UpdateProcessData(data *processing.ProcessData) {
-	userId := staticFunctions.GetDb(data.Static).GetOrCreateTelegramUserId(data.ChatId, data.UserSystemLang)
+	db := staticFunctions.GetDb(data.Static)
+	userId := db.GetOrCreateTelegramUserId(data.ChatId, data.UserSystemLang)
+	db.MarkUserActive(userId)
 	data.UserId = userId
 	data.Trans = staticFunctions.FindTransFunction(userId, data.Static)
 }
@@ -136,6 +184,21 @@ func processCommand(data *processing.ProcessData, dialogManager *dialogManager.D
 	return false
 }
 
+// processGroupCommand handles a command sent in a group chat, data.ChatId is the group and data.UserId is the sender,
+// other commands are ignored to not answer the commands of other bots in the group.
+// The members of the group who never started the bot get no user until they join a game, data.UserId is 0 for them
+func processGroupCommand(data *processing.ProcessData, senderChatId int64, groupProcessors *ProcessorFuncMap) {
+	db := staticFunctions.GetDb(data.Static)
+	if userId, isFound := db.FindTelegramUserId(senderChatId); isFound {
+		db.MarkUserActive(userId)
+		data.UserId = userId
+		data.Trans = staticFunctions.FindTransFunction(userId, data.Static)
+	} else {
+		data.Trans = staticFunctions.GetTranslator(data.Static, data.UserSystemLang)
+	}
+	processCommandByProcessors(data, groupProcessors)
+}
+
 func processPlainMessage(data *processing.ProcessData, dialogManager *dialogManager.DialogManager) {
 	UpdateProcessData(data)
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/gameraccoon/telegram-spy-game-bot/httpServer"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+const reloaderKey = "reloader"
+
+// reloader replaces the configuration, the translations and the web pages without restarting the bot
+type reloader struct {
+	options   *launchOptions
+	storage   *static.ConfigStorage
+	htmlCache *httpServer.HtmlCache
+	// updates the menu of the commands in Telegram with the new translations, not set in the simulation
+	publishCommands func(config *static.StaticConfiguration, translators map[string]i18n.TranslateFunc)
+	// to not run two reloads at the same time
+	mutex sync.Mutex
+}
+
+// reload applies the new data only if all of it is valid, otherwise keeps the old data and returns the problems
+func (reloader *reloader) reload() (problems []string) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	config, translators, problems := loadAndValidateConfig(reloader.options)
+	if len(problems) > 0 {
+		log.Printf("Reload canceled, found %d problems", len(problems))
+		return
+	}
+
+	if reloader.htmlCache != nil {
+		err := reloader.htmlCache.Reload()
+		if err != nil {
+			log.Printf("Reload canceled: %s", err.Error())
+			return []string{err.Error()}
+		}
+	}
+
+	oldConfig := reloader.storage.GetConfig()
+	if oldConfig.RunHttpServer != config.RunHttpServer || oldConfig.HttpServerPort != config.HttpServerPort ||
+		oldConfig.CleanupIntervalMinutes != config.CleanupIntervalMinutes || oldConfig.UseWebhook != config.UseWebhook ||
+		oldConfig.WebhookUrl != config.WebhookUrl || oldConfig.WebhookPath != config.WebhookPath ||
+		oldConfig.WebhookSecretToken != config.WebhookSecretToken || oldConfig.HttpBindAddress != config.HttpBindAddress ||
+		oldConfig.TlsCertFile != config.TlsCertFile || oldConfig.TlsKeyFile != config.TlsKeyFile ||
+		!slices.Equal(oldConfig.TrustedProxies, config.TrustedProxies) {
+		log.Print("HTTP server, webhook and cleanup interval changes will be applied only after restart")
+	}
+
+	reloader.storage.Set(config, translators)
+	log.Print("Configuration reloaded")
+
+	if reloader.publishCommands != nil {
+		reloader.publishCommands(&config, translators)
+	}
+	return
+}
+
+func reloadOnSignal(reloader *reloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		log.Print("Got SIGHUP, reloading")
+		for _, problem := range reloader.reload() {
+			log.Print(problem)
+		}
+	}
+}
@@ -0,0 +1,759 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	"github.com/gameraccoon/telegram-spy-game-bot/httpServer"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type sentMessage struct {
+	messageId int64
+	text      string
+	dialog    *dialog.Dialog
+	image     []byte
+}
+
+// testChat records everything the bot sends, the updates are passed to the bot by testBot
+type testChat struct {
+	mutex         sync.Mutex
+	lastMessageId int64
+	messages      map[int64][]sentMessage
+	// the users who never started the bot, Telegram doesn't let the bot write to them
+	unreachableChats map[int64]bool
+	// the answers to the inline queries and to the buttons of the inline messages by the query ids
+	inlineResults   map[string][]transport.InlineArticle
+	callbackAnswers map[string]callbackAnswer
+}
+
+type callbackAnswer struct {
+	text string
+	url  string
+}
+
+func (chat *testChat) record(chatId int64, message sentMessage, messageToReplace int64) int64 {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+
+	if chat.unreachableChats[chatId] {
+		return 0
+	}
+
+	if messageToReplace != 0 {
+		message.messageId = messageToReplace
+	} else {
+		chat.lastMessageId++
+		message.messageId = chat.lastMessageId
+	}
+	chat.messages[chatId] = append(chat.messages[chatId], message)
+	return message.messageId
+}
+
+func (chat *testChat) SendMessage(chatId int64, message string, messageToReplace int64, preventPreview bool) int64 {
+	return chat.record(chatId, sentMessage{text: message}, messageToReplace)
+}
+
+func (chat *testChat) SendDialog(chatId int64, dialog *dialog.Dialog, messageToReplace int64) int64 {
+	return chat.record(chatId, sentMessage{text: dialog.Text, dialog: dialog}, messageToReplace)
+}
+
+func (chat *testChat) SendPhoto(chatId int64, fileName string, image []byte, caption string) int64 {
+	return chat.record(chatId, sentMessage{text: caption, image: image}, 0)
+}
+
+func (chat *testChat) AnswerInlineQuery(queryId string, articles []transport.InlineArticle) {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	chat.inlineResults[queryId] = articles
+}
+
+func (chat *testChat) AnswerCallbackQuery(queryId string, text string, url string) {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	chat.callbackAnswers[queryId] = callbackAnswer{text: text, url: url}
+}
+
+func (chat *testChat) RemoveMessage(chatId int64, messageId int64) {
+}
+
+func (chat *testChat) GetBotUsername() string {
+	return "test_bot"
+}
+
+func (chat *testChat) ReceiveUpdates() (<-chan tgbotapi.Update, error) {
+	return nil, fmt.Errorf("testBot passes the updates directly")
+}
+
+func (chat *testChat) StopReceivingUpdates() {
+}
+
+// takeMessages returns the messages sent to the chat since the previous call
+func (chat *testChat) takeMessages(chatId int64) []sentMessage {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+
+	messages := chat.messages[chatId]
+	delete(chat.messages, chatId)
+	return messages
+}
+
+type testBot struct {
+	t            *testing.T
+	chat         *testChat
+	db           *database.SpyBotDb
+	staticData   *processing.StaticProccessStructs
+	webServer    *httptest.Server
+	trans        i18n.TranslateFunc
+	lastUpdateId int
+}
+
+const testAdminChatId = int64(1)
+
+func makeTestBotConfig() static.StaticConfiguration {
+	return static.StaticConfiguration{
+		AvailableLanguages: []static.LanguageData{{Key: "en-us", Name: "English"}, {Key: "ru-ru", Name: "Русский"}},
+		DefaultLanguage:    "en-us",
+		AdminTelegramIds:   []int64{testAdminChatId},
+		SpyfallLocations: []static.SpyfallLocation{
+			{LocationId: "airplane", Roles: []string{"1stclasspassenger", "airmarshall", "mechanic"}},
+			{LocationId: "bank", Roles: []string{"armoredcardriver", "bankmanager", "loanconsultant"}},
+		},
+		RunHttpServer:   true,
+		HttpServerPort:  8080,
+		ShareWebAddress: "https://example.com",
+		TrustedProxies:  []string{"127.0.0.1"},
+	}
+}
+
+func startTestBot(t *testing.T, seed int64) *testBot {
+	assert := require.New(t)
+
+	config := makeTestBotConfig()
+	translators, ids, problems := loadTranslations(config.AvailableLanguages, "./data/strings")
+	assert.Empty(problems)
+	assert.Empty(validateConfig(&config, ids))
+	assert.Empty(validateCommandDescriptions(&config, translators))
+
+	// every test gets its own database that disappears when the last connection is closed
+	db, err := database.ConnectDb(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	assert.NoError(err)
+	t.Cleanup(db.Disconnect)
+
+	staticFunctions.SetGameRandomSeed(seed)
+
+	chat := &testChat{
+		messages:         make(map[int64][]sentMessage),
+		unreachableChats: make(map[int64]bool),
+		inlineResults:    make(map[string][]transport.InlineArticle),
+		callbackAnswers:  make(map[string]callbackAnswer),
+	}
+	staticData := makeStaticData(chat, db, static.MakeConfigStorage(config, translators), makeDialogManager())
+
+	htmlCache, err := httpServer.LoadHtmlCache("")
+	assert.NoError(err)
+	webServer := httptest.NewServer(httpServer.MakeHandler(htmlCache, staticData))
+	t.Cleanup(webServer.Close)
+
+	return &testBot{
+		t:          t,
+		chat:       chat,
+		db:         db,
+		staticData: staticData,
+		webServer:  webServer,
+		trans:      translators["en-us"],
+	}
+}
+
+// process passes the updates through the same pipeline as the real ones and waits until they are processed,
+// the updates are passed one by one since the user states of the skeleton can't be changed concurrently
+func (bot *testBot) process(update tgbotapi.Update) {
+	bot.lastUpdateId++
+	update.UpdateID = bot.lastUpdateId
+
+	updates := make(chan tgbotapi.Update, 1)
+	updates <- update
+	close(updates)
+	updateBot(context.Background(), updates, func() {}, bot.staticData, makeDialogManager())
+}
+
+func makeTestUser(chatId int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: int(chatId), FirstName: "Player", LanguageCode: "en"}
+}
+
+func (bot *testBot) sendText(chatId int64, text string) {
+	bot.process(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: makeTestUser(chatId),
+			Chat: &tgbotapi.Chat{ID: chatId, Type: "private"},
+			Text: text,
+		},
+	})
+}
+
+func (bot *testBot) sendGroupText(groupChatId int64, fromChatId int64, text string) {
+	bot.process(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: makeTestUser(fromChatId),
+			Chat: &tgbotapi.Chat{ID: groupChatId, Type: "group"},
+			Text: text,
+		},
+	})
+}
+
+// pressButton presses a button of the last dialog that the user got
+func (bot *testBot) pressButton(chatId int64, messages []sentMessage, variantId string) {
+	bot.pressButtonInChat(chatId, chatId, messages, variantId)
+}
+
+// pressButtonInChat presses a button of the last dialog in a chat, e.g. in a group chat
+func (bot *testBot) pressButtonInChat(chatId int64, fromChatId int64, messages []sentMessage, variantId string) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		sentDialog := messages[i].dialog
+		if sentDialog == nil {
+			continue
+		}
+		for _, variant := range sentDialog.Variants {
+			if variant.Id == variantId {
+				data := "/" + sentDialog.Id + "_" + variant.Id
+				if variant.AdditionalId != "" {
+					data += "_" + variant.AdditionalId
+				}
+				bot.process(tgbotapi.Update{
+					CallbackQuery: &tgbotapi.CallbackQuery{
+						From:    makeTestUser(fromChatId),
+						Message: &tgbotapi.Message{MessageID: int(messages[i].messageId), Chat: &tgbotapi.Chat{ID: chatId}},
+						Data:    data,
+					},
+				})
+				return
+			}
+		}
+		break
+	}
+	bot.t.Fatalf("user %d has no dialog with button %s", chatId, variantId)
+}
+
+// callApi sends a JSON request to the web API and decodes the JSON response
+func (bot *testBot) callApi(method string, path string, request interface{}, response interface{}) (status int) {
+	return bot.callApiWithHeaders(method, path, nil, request, response)
+}
+
+// getApiAsPlayer passes the token in the header, the way the clients without cookies make the GET requests
+func (bot *testBot) getApiAsPlayer(path string, playerToken string, response interface{}) (status int) {
+	return bot.callApiWithHeaders(http.MethodGet, path, map[string]string{"X-Player-Token": playerToken}, nil, response)
+}
+
+func (bot *testBot) callApiWithHeaders(method string, path string, headers map[string]string, request interface{}, response interface{}) (status int) {
+	assert := require.New(bot.t)
+
+	var body io.Reader
+	if request != nil {
+		requestJson, err := json.Marshal(request)
+		assert.NoError(err)
+		body = bytes.NewReader(requestJson)
+	}
+
+	httpRequest, err := http.NewRequest(method, bot.webServer.URL+path, body)
+	assert.NoError(err)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	assert.NoError(err)
+	defer httpResponse.Body.Close()
+
+	assert.Equal("application/json", httpResponse.Header.Get("Content-Type"))
+	if response != nil {
+		assert.NoError(json.NewDecoder(httpResponse.Body).Decode(response))
+	}
+	return httpResponse.StatusCode
+}
+
+func (bot *testBot) joinFromWeb(sessionToken string) (webUserId int64, playerToken string) {
+	assert := require.New(bot.t)
+
+	var response struct {
+		PlayerToken string `json:"playerToken"`
+	}
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/join", map[string]string{"gameId": sessionToken}, &response))
+
+	webUserId, isFound := bot.db.GetWebUserId(response.PlayerToken)
+	assert.True(isFound)
+	return webUserId, response.PlayerToken
+}
+
+func (bot *testBot) getUserId(chatId int64) int64 {
+	return bot.db.GetOrCreateTelegramUserId(chatId, "en")
+}
+
+func TestMultiplayerSpyfallScenario(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	const host = int64(100)
+	telegramPlayers := []int64{host, 101, 102, 103}
+
+	bot.sendText(host, "/start")
+	messages := bot.chat.takeMessages(host)
+	assert.Equal(bot.trans("start_message"), messages[0].text)
+
+	bot.pressButton(host, messages, "createsess")
+	sessionId, isInSession := bot.db.GetUserSession(bot.getUserId(host))
+	assert.True(isInSession)
+	sessionToken, isFound := bot.db.GetTokenFromSessionId(sessionId)
+	assert.True(isFound)
+
+	for _, chatId := range telegramPlayers[1:] {
+		bot.sendText(chatId, "/start spyfall-"+sessionToken)
+		joinedSessionId, isInSession := bot.db.GetUserSession(bot.getUserId(chatId))
+		assert.True(isInSession)
+		assert.Equal(sessionId, joinedSessionId)
+		messages := bot.chat.takeMessages(chatId)
+		assert.Equal(bot.trans("link_joined_game", map[string]interface{}{"Game": bot.trans("invite_spyfall")}), messages[len(messages)-1].text)
+	}
+
+	firstWebPlayer, _ := bot.joinFromWeb(sessionToken)
+	secondWebPlayer, _ := bot.joinFromWeb(sessionToken)
+	webPlayers := []int64{firstWebPlayer, secondWebPlayer}
+	assert.Equal(int64(len(telegramPlayers)+len(webPlayers)), bot.db.GetUsersCountInSession(sessionId, false))
+
+	// broken and old links don't add anyone
+	bot.sendText(200, "/start wrongtoken")
+	assert.Equal(bot.trans("link_malformed"), bot.chat.takeMessages(200)[0].text)
+	bot.sendText(200, "/start chess-"+sessionToken)
+	assert.Equal(bot.trans("link_malformed"), bot.chat.takeMessages(200)[0].text)
+	bot.sendText(200, "/start spyfall-"+strings.Repeat("a", len(sessionToken)))
+	assert.Equal(bot.trans("link_session_ended"), bot.chat.takeMessages(200)[0].text)
+	assert.Equal(int64(len(telegramPlayers)), bot.db.GetUsersCountInSession(sessionId, true))
+
+	for _, chatId := range telegramPlayers {
+		bot.chat.takeMessages(chatId)
+	}
+
+	spyText := "You are the Spy"
+	// the web page asks for the messages after index -1 at first
+	webMessageIndexes := []int{-1, -1}
+	for round := 0; round < 5; round++ {
+		bot.sendText(host, "/spyfall_send")
+
+		var themes []string
+		for _, chatId := range telegramPlayers {
+			messages := bot.chat.takeMessages(chatId)
+			assert.Len(messages, 1, "player %d", chatId)
+			themes = append(themes, messages[0].text)
+		}
+		for i, userId := range webPlayers {
+			var webMessages []string
+			webMessages, webMessageIndexes[i] = bot.db.GetNewRecentWebMessages(userId, webMessageIndexes[i])
+			assert.Len(webMessages, 1, "web player %d", userId)
+			themes = append(themes, webMessages[0])
+		}
+
+		spiesCount := 0
+		var locations []string
+		for _, theme := range themes {
+			if strings.Contains(theme, spyText) {
+				spiesCount++
+				continue
+			}
+			locationLine := strings.TrimSpace(strings.TrimPrefix(strings.Split(theme, "\n")[0], "<tg-spoiler>"))
+			assert.True(strings.HasPrefix(locationLine, "Location: "), theme)
+			assert.Contains(theme, "Role: ")
+			locations = append(locations, locationLine)
+		}
+		assert.Equal(1, spiesCount, "round %d", round)
+		for _, location := range locations {
+			assert.Equal(locations[0], location, "everyone except the spy should be at the same location")
+		}
+	}
+}
+
+func TestSpyfallNeedsTwoPlayers(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	const host = int64(100)
+	bot.sendText(host, "/spyfall_send")
+	assert.Equal(bot.trans("no_session_error"), bot.chat.takeMessages(host)[0].text)
+
+	bot.sendText(host, "/session")
+	bot.pressButton(host, bot.chat.takeMessages(host), "createsess")
+	bot.chat.takeMessages(host)
+
+	bot.sendText(host, "/spyfall_send")
+	assert.Equal(bot.trans("few_players"), bot.chat.takeMessages(host)[0].text)
+}
+
+func TestSpyfallRolesRepeatWhenPlayersOutnumberRoles(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 3)
+
+	// every test location has three roles, so five players besides the spy need some roles to be given twice
+	const host = int64(100)
+	players := []int64{host, 101, 102, 103, 104, 105}
+
+	bot.sendText(host, "/session")
+	bot.pressButton(host, bot.chat.takeMessages(host), "createsess")
+	sessionId, _ := bot.db.GetUserSession(bot.getUserId(host))
+	sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+	for _, chatId := range players[1:] {
+		bot.sendText(chatId, "/start spyfall-"+sessionToken)
+	}
+	for _, chatId := range players {
+		bot.chat.takeMessages(chatId)
+	}
+
+	for round := 0; round < 5; round++ {
+		bot.sendText(host, "/spyfall_send")
+
+		spiesCount := 0
+		rolesCount := make(map[string]int)
+		for _, chatId := range players {
+			messages := bot.chat.takeMessages(chatId)
+			assert.Len(messages, 1, "player %d", chatId)
+			if strings.Contains(messages[0].text, "You are the Spy") {
+				spiesCount++
+				continue
+			}
+			roleLine := strings.TrimSpace(strings.Split(messages[0].text, "\n")[1])
+			assert.True(strings.HasPrefix(roleLine, "Role: "), messages[0].text)
+			assert.NotEqual("Role:", roleLine, "every player except the spy should get a role")
+			rolesCount[roleLine]++
+		}
+		assert.Equal(1, spiesCount, "round %d", round)
+		assert.Len(rolesCount, 3, "every role should be given before any role is given twice")
+		for role, count := range rolesCount {
+			assert.LessOrEqual(count, 2, role)
+		}
+	}
+
+	// the roles are shuffled in a copy, the config shared by the sessions stays the same
+	config, _ := staticFunctions.GetConfig(bot.staticData)
+	assert.Equal(makeTestBotConfig().SpyfallLocations, config.SpyfallLocations)
+}
+
+func TestTypedThemeScenario(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 5)
+
+	const host = int64(100)
+	telegramPlayers := []int64{host, 101, 102}
+
+	// a text typed outside of the session is answered with the help
+	bot.sendText(host, "Museum")
+	assert.Equal(bot.trans("help_info"), bot.chat.takeMessages(host)[0].text)
+
+	bot.sendText(host, "/session")
+	bot.pressButton(host, bot.chat.takeMessages(host), "createsess")
+	sessionId, _ := bot.db.GetUserSession(bot.getUserId(host))
+	sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+
+	// the sender doesn't get the theme, so there should be someone else to get it
+	bot.chat.takeMessages(host)
+	bot.sendText(host, "Museum")
+	assert.Equal(bot.trans("few_players"), bot.chat.takeMessages(host)[0].text)
+
+	for _, chatId := range telegramPlayers[1:] {
+		bot.sendText(chatId, "/start spyfall-"+sessionToken)
+	}
+	webPlayer, _ := bot.joinFromWeb(sessionToken)
+	for _, chatId := range telegramPlayers {
+		bot.chat.takeMessages(chatId)
+	}
+
+	webMessageIndex := -1
+	for round := 0; round < 5; round++ {
+		bot.sendText(host, "Museum")
+
+		messages := bot.chat.takeMessages(host)
+		assert.Len(messages, 1)
+		assert.Equal(bot.trans("theme_sent"), messages[0].text)
+
+		var themes []string
+		for _, chatId := range telegramPlayers[1:] {
+			messages := bot.chat.takeMessages(chatId)
+			assert.Len(messages, 1, "player %d", chatId)
+			assert.True(strings.HasPrefix(messages[0].text, "<tg-spoiler>"), messages[0].text)
+			themes = append(themes, strings.TrimSpace(strings.TrimPrefix(strings.Split(messages[0].text, "\n")[0], "<tg-spoiler>")))
+		}
+		var webMessages []string
+		webMessages, webMessageIndex = bot.db.GetNewRecentWebMessages(webPlayer, webMessageIndex)
+		assert.Len(webMessages, 1)
+		themes = append(themes, webMessages[0])
+
+		spiesCount := 0
+		for _, theme := range themes {
+			if theme == bot.trans("theme_spy") {
+				spiesCount++
+			} else {
+				assert.Equal("Museum", theme)
+			}
+		}
+		assert.Equal(1, spiesCount, "round %d", round)
+	}
+}
+
+func TestScenarioIsReproducible(t *testing.T) {
+	playRound := func(t *testing.T) []string {
+		bot := startTestBot(t, 42)
+		bot.sendText(100, "/session")
+		bot.pressButton(100, bot.chat.takeMessages(100), "createsess")
+		sessionId, _ := bot.db.GetUserSession(bot.getUserId(100))
+		sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+		bot.sendText(101, "/start "+sessionToken)
+		bot.sendText(102, "/start "+sessionToken)
+		for _, chatId := range []int64{100, 101, 102} {
+			bot.chat.takeMessages(chatId)
+		}
+
+		bot.sendText(100, "/spyfall_send")
+		var themes []string
+		for _, chatId := range []int64{100, 101, 102} {
+			themes = append(themes, bot.chat.takeMessages(chatId)[0].text)
+		}
+		return themes
+	}
+
+	var firstRun, secondRun []string
+	t.Run("first", func(t *testing.T) { firstRun = playRound(t) })
+	t.Run("second", func(t *testing.T) { secondRun = playRound(t) })
+	require.Equal(t, firstRun, secondRun)
+}
+
+func TestGroupChatGame(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	const group = int64(-500)
+	players := []int64{100, 101, 102}
+
+	// the commands for other bots in the group are not answered
+	bot.sendGroupText(group, 100, "/newgame@other_bot")
+	assert.Empty(bot.chat.takeMessages(group))
+
+	bot.sendGroupText(group, 100, "/newgame@test_bot")
+	groupMessages := bot.chat.takeMessages(group)
+	assert.Len(groupMessages, 1)
+	assert.Equal(bot.trans("group_game_title", map[string]interface{}{"Participants": 0}), groupMessages[0].text)
+	// the group itself is not a player, and the member who started the game becomes one only after joining it
+	_, isFound := bot.db.GetTelegramUserChatId(group)
+	assert.False(isFound)
+	_, isFound = bot.db.FindTelegramUserId(100)
+	assert.False(isFound)
+
+	bot.pressButtonInChat(group, 100, groupMessages, "join")
+	bot.pressButtonInChat(group, 101, groupMessages, "join")
+	sessionId, isInSession := bot.db.GetUserSession(bot.getUserId(100))
+	assert.True(isInSession)
+	joinedSessionId, _ := bot.db.GetUserSession(bot.getUserId(101))
+	assert.Equal(sessionId, joinedSessionId)
+	assert.Equal(bot.trans("group_game_joining"), bot.chat.takeMessages(101)[0].text)
+
+	// the message of the group shows the players
+	updatedMessages := bot.chat.takeMessages(group)
+	assert.Equal(bot.trans("group_game_title", map[string]interface{}{"Participants": 2}), updatedMessages[len(updatedMessages)-1].text)
+	assert.Equal(groupMessages[0].messageId, updatedMessages[len(updatedMessages)-1].messageId)
+
+	// the number of the group session can't be used to join without the button of the group
+	bot.sendText(103, fmt.Sprintf("/gr_join_%d", sessionId))
+	assert.Equal(bot.trans("help_info"), bot.chat.takeMessages(103)[0].text)
+	bot.process(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			From:    makeTestUser(103),
+			Message: &tgbotapi.Message{MessageID: int(groupMessages[0].messageId) + 1000, Chat: &tgbotapi.Chat{ID: 103}},
+			Data:    fmt.Sprintf("/gr_join_%d", sessionId),
+		},
+	})
+	_, isInSession = bot.db.GetUserSession(bot.getUserId(103))
+	assert.False(isInSession)
+
+	// a player who never started the bot gets a link to do it
+	bot.chat.unreachableChats[102] = true
+	bot.pressButtonInChat(group, 102, groupMessages, "join")
+	_, isInSession = bot.db.GetUserSession(bot.getUserId(102))
+	assert.False(isInSession)
+	sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+	prompt := bot.chat.takeMessages(group)
+	assert.Len(prompt, 1)
+	assert.Equal(bot.trans("group_start_bot_first", map[string]interface{}{
+		"Name": "Player",
+		"Link": "https://t.me/test_bot?start=" + sessionToken,
+	}), prompt[0].text)
+
+	bot.chat.unreachableChats[102] = false
+	bot.sendText(102, "/start "+sessionToken)
+	joinedSessionId, _ = bot.db.GetUserSession(bot.getUserId(102))
+	assert.Equal(sessionId, joinedSessionId)
+	bot.chat.takeMessages(group)
+	for _, chatId := range players {
+		bot.chat.takeMessages(chatId)
+	}
+
+	// the roles are secret and the round start is public
+	bot.sendText(100, "/spyfall_send")
+	for _, chatId := range players {
+		assert.Len(bot.chat.takeMessages(chatId), 1)
+	}
+	groupMessages = bot.chat.takeMessages(group)
+	assert.Len(groupMessages, 1)
+	assert.Equal(bot.trans("group_round_started"), groupMessages[0].text)
+
+	// a new game in the group doesn't take the players from the current one
+	bot.sendGroupText(group, 101, "/newgame")
+	assert.Len(bot.chat.takeMessages(group), 1)
+	joinedSessionId, _ = bot.db.GetUserSession(bot.getUserId(101))
+	assert.Equal(sessionId, joinedSessionId)
+	bot.sendText(100, "/number")
+	assert.Empty(bot.chat.takeMessages(group))
+}
+
+func TestInlineInvite(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sendInlineQuery := func(queryId string, fromChatId int64) []transport.InlineArticle {
+		bot.process(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{ID: queryId, From: makeTestUser(fromChatId)}})
+		return bot.chat.inlineResults[queryId]
+	}
+	pressInlineButton := func(queryId string, fromChatId int64, data string) callbackAnswer {
+		bot.process(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{ID: queryId, From: makeTestUser(fromChatId), InlineMessageID: "inline", Data: data}})
+		return bot.chat.callbackAnswers[queryId]
+	}
+
+	// nothing to share without a session
+	assert.Empty(sendInlineQuery("q1", 100))
+	bot.sendText(100, "/start")
+	assert.Empty(sendInlineQuery("q2", 100))
+
+	bot.pressButton(100, bot.chat.takeMessages(100), "createsess")
+	sessionId, _ := bot.db.GetUserSession(bot.getUserId(100))
+	sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+
+	articles := sendInlineQuery("q3", 100)
+	assert.Len(articles, len(staticFunctions.InviteGameTypes))
+	assert.Equal(bot.trans("invite_inline_title", map[string]interface{}{"Game": bot.trans("invite_spyfall")}), articles[0].Title)
+	assert.Equal("/join spyfall-"+sessionToken, articles[0].ButtonData)
+	// the callback data of Telegram buttons is limited
+	for _, article := range articles {
+		assert.LessOrEqual(len(article.ButtonData), 64)
+	}
+
+	// the button opens the bot that joins the game
+	answer := pressInlineButton("c1", 101, articles[0].ButtonData)
+	assert.Equal(callbackAnswer{url: "https://t.me/test_bot?start=spyfall-" + sessionToken}, answer)
+	bot.sendText(101, "/start spyfall-"+sessionToken)
+	joinedSessionId, _ := bot.db.GetUserSession(bot.getUserId(101))
+	assert.Equal(sessionId, joinedSessionId)
+	bot.chat.takeMessages(100)
+
+	// sending the invite is not a message to the bot
+	bot.process(tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{ResultID: "spyfall", From: makeTestUser(100)}})
+	assert.Empty(bot.chat.takeMessages(100))
+
+	assert.Equal(callbackAnswer{text: bot.trans("link_malformed")}, pressInlineButton("c2", 102, "/join broken"))
+
+	assert.Equal(callbackAnswer{text: bot.trans("link_session_ended")}, pressInlineButton("c3", 102, "/join spyfall-"+strings.Repeat("a", len(sessionToken))))
+}
+
+func TestAdminCommands(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	const admin = testAdminChatId
+	lastMessage := func(chatId int64) string {
+		messages := bot.chat.takeMessages(chatId)
+		assert.NotEmpty(messages)
+		return messages[len(messages)-1].text
+	}
+
+	// the admin commands are hidden from the other users and not recorded
+	bot.sendText(100, "/stats")
+	assert.Equal(bot.trans("help_info"), lastMessage(100))
+	assert.Empty(bot.db.GetRecentAdminAuditRecords(10))
+
+	bot.sendText(admin, "/sessions")
+	assert.Equal(bot.trans("admin_no_sessions"), lastMessage(admin))
+
+	bot.sendText(100, "/start")
+	bot.pressButton(100, bot.chat.takeMessages(100), "createsess")
+	sessionId, _ := bot.db.GetUserSession(bot.getUserId(100))
+	sessionToken, _ := bot.db.GetTokenFromSessionId(sessionId)
+	bot.sendText(101, "/start spyfall-"+sessionToken)
+	webPlayer, _ := bot.joinFromWeb(sessionToken)
+	bot.chat.takeMessages(100)
+	bot.chat.takeMessages(101)
+
+	bot.sendText(admin, "/sessions")
+	assert.Contains(lastMessage(admin), bot.trans("admin_session_line", map[string]interface{}{
+		"Id":          sessionId,
+		"Players":     3,
+		"IdleMinutes": 0,
+	}))
+
+	bot.sendText(admin, "/stats")
+	stats := lastMessage(admin)
+	assert.Contains(stats, "<b>Sessions:</b> 1")
+	assert.Contains(stats, "<b>Players in sessions:</b> 3")
+	assert.Contains(stats, "<b>Web players:</b> 1")
+
+	bot.sendText(admin, "/broadcast")
+	assert.Equal(bot.trans("admin_broadcast_usage"), lastMessage(admin))
+	bot.sendText(admin, "/broadcast Restart in <5> minutes")
+	assert.Equal(bot.trans("admin_broadcast_started", map[string]interface{}{"Total": 4}), lastMessage(admin))
+	getAdminJobs(bot.staticData).wait()
+	broadcast := bot.trans("broadcast_message", map[string]interface{}{"Text": "Restart in &lt;5&gt; minutes"})
+	assert.Equal(broadcast, lastMessage(100))
+	assert.Equal(broadcast, lastMessage(101))
+	webMessages, _ := bot.db.GetNewRecentWebMessages(webPlayer, -1)
+	assert.Contains(webMessages, broadcast)
+	// the admin is also a user
+	assert.Equal(bot.trans("admin_broadcast_sent", map[string]interface{}{"Sent": 4, "Total": 4}), lastMessage(admin))
+
+	bot.sendText(admin, "/close_session abc")
+	assert.Equal(bot.trans("admin_close_session_usage"), lastMessage(admin))
+	bot.sendText(admin, fmt.Sprintf("/close_session %d", sessionId+1))
+	assert.Equal(bot.trans("admin_session_not_found"), lastMessage(admin))
+	bot.sendText(admin, fmt.Sprintf("/close_session %d", sessionId))
+	assert.Equal(bot.trans("admin_session_closed", map[string]interface{}{"Id": sessionId}), lastMessage(admin))
+	assert.Equal(bot.trans("session_closed_by_admin"), lastMessage(100))
+	assert.Equal(bot.trans("session_closed_by_admin"), lastMessage(101))
+	assert.False(bot.db.DoesSessionExist(sessionId))
+
+	bot.sendText(admin, "/audit")
+	audit := lastMessage(admin)
+	assert.Contains(audit, bot.trans("admin_audit_title", map[string]interface{}{"Count": 9}))
+	assert.Contains(audit, "/broadcast Restart in &lt;5&gt; minutes")
+
+	records := bot.db.GetRecentAdminAuditRecords(100)
+	assert.Len(records, 9)
+	assert.Equal("audit", records[0].Action)
+	assert.Equal("close_session", records[1].Action)
+	assert.Equal(fmt.Sprint(sessionId), records[1].Details)
+	assert.Equal(admin, records[1].AdminChatId)
+	assert.Equal("broadcast", records[4].Action)
+	assert.Equal("Restart in <5> minutes", records[4].Details)
+
+	// the broadcast stops when the bot is shutting down, the web player has left with the closed session
+	getAdminJobs(bot.staticData).stop()
+	bot.sendText(admin, "/broadcast Restarting")
+	getAdminJobs(bot.staticData).wait()
+	assert.Equal(bot.trans("admin_broadcast_stopped", map[string]interface{}{"Sent": 0, "Total": 3}), lastMessage(admin))
+}
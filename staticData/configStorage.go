@@ -0,0 +1,39 @@
+package staticData
+
+import (
+	"github.com/nicksnyder/go-i18n/i18n"
+	"sync/atomic"
+)
+
+type reloadableData struct {
+	config      StaticConfiguration
+	translators map[string]i18n.TranslateFunc
+}
+
+// ConfigStorage keeps the configuration and the translations that can be replaced while the bot is running,
+// the readers always get a consistent pair of them
+type ConfigStorage struct {
+	data atomic.Pointer[reloadableData]
+}
+
+func MakeConfigStorage(config StaticConfiguration, translators map[string]i18n.TranslateFunc) *ConfigStorage {
+	storage := &ConfigStorage{}
+	storage.Set(config, translators)
+	return storage
+}
+
+func (storage *ConfigStorage) Set(config StaticConfiguration, translators map[string]i18n.TranslateFunc) {
+	storage.data.Store(&reloadableData{
+		config:      config,
+		translators: translators,
+	})
+}
+
+func (storage *ConfigStorage) GetConfig() StaticConfiguration {
+	return storage.data.Load().config
+}
+
+// GetTranslators returns a map that should not be modified
+func (storage *ConfigStorage) GetTranslators() map[string]i18n.TranslateFunc {
+	return storage.data.Load().translators
+}
@@ -17,5 +17,38 @@ type StaticConfiguration struct {
 	SpyfallLocations   []SpyfallLocation
 	RunHttpServer      bool
 	HttpServerPort     int
-	ShareWebAddress    string
+	// all the interfaces if not set
+	HttpBindAddress string
+	// serve HTTPS directly, the files are reloaded when they change
+	TlsCertFile string
+	TlsKeyFile  string
+	// addresses or networks of the reverse proxies, X-Forwarded-For and X-Forwarded-Proto are used only from them
+	TrustedProxies  []string
+	ShareWebAddress string
+	// zero values disable the cleanup of the corresponding entities
+	SessionIdleTimeoutMinutes int
+	WebUserIdleTimeoutMinutes int
+	CleanupIntervalMinutes    int
+	// Telegram ids of the users that can run administrative commands
+	AdminTelegramIds []int64
+	// stop per-user update workers after this idle time, 30 minutes if not set
+	UserWorkerIdleTimeoutMinutes int
+	// how many not processed updates a user can have, the next ones are dropped, 10 if not set
+	UserQueueSize   int
+	BackupDirectory string
+	// receive updates from Telegram on the HTTP server instead of long polling
+	UseWebhook bool
+	// public HTTPS address that Telegram sends the updates to
+	WebhookUrl string
+	// path that the HTTP server listens to for the updates, the path of WebhookUrl if not set
+	WebhookPath        string
+	WebhookSecretToken string
+	// limits against flooding from the web, the defaults are used if not set
+	ApiRequestsPerMinutePerIp int
+	// both joining and creating games
+	JoinsPerMinutePerIp      int
+	JoinsPerMinutePerSession int
+	// counts both Telegram and web players
+	MaxPlayersInSession int
+	MaxThemeLength      int
 }
@@ -2,10 +2,8 @@ package staticFunctions
 
 import (
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
 	"github.com/nicksnyder/go-i18n/i18n"
 	"log"
-	"math/rand"
 	"strings"
 )
 
@@ -16,14 +14,14 @@ func SendThemeToPlayers(staticData *processing.StaticProccessStructs, userIds []
 		return false
 	}
 
-	spyIdx := rand.Intn(len(userIds))
+	spyIdx := randomIntn(len(userIds))
 
 	for i, userId := range userIds {
 		trans := FindTransFunction(userId, staticData)
 
 		var themeMessage string
 		if i == spyIdx {
-			themeMessage = "<tg-spoiler>" + trans("theme_spy") + "</tg-spoiler>"
+			themeMessage = trans("theme_spy")
 		} else {
 			themeMessage = theme
 		}
@@ -32,7 +30,7 @@ func SendThemeToPlayers(staticData *processing.StaticProccessStructs, userIds []
 		if isFound {
 			staticData.Chat.SendMessage(chatId, wrapIntoTelegramSpoiler(themeMessage, trans), 0, true)
 		} else {
-			db.AddWebMessage(userId, themeMessage, 10)
+			SendWebMessage(staticData, userId, themeMessage)
 		}
 	}
 	return true
@@ -47,13 +45,17 @@ func SendThemeToOthers(staticData *processing.StaticProccessStructs, sessionId i
 		}
 	}
 
-	return SendThemeToPlayers(staticData, playersExceptCurrent, theme)
+	success = SendThemeToPlayers(staticData, playersExceptCurrent, theme)
+	if success {
+		AnnounceToGroup(staticData, sessionId, "group_round_started")
+	}
+	return
 }
 
 func SendSpyfallLocationToAll(staticData *processing.StaticProccessStructs, sessionId int64) (success bool) {
 	db := GetDb(staticData)
 
-	config, configCastSuccess := staticData.Config.(static.StaticConfiguration)
+	config, configCastSuccess := GetConfig(staticData)
 
 	if !configCastSuccess {
 		log.Print("Config type is incorrect")
@@ -67,11 +69,8 @@ func SendSpyfallLocationToAll(staticData *processing.StaticProccessStructs, sess
 		return false
 	}
 
-	locationIdx := rand.Intn(locationsCount)
+	locationIdx := randomIntn(locationsCount)
 	locationInfoCopy := config.SpyfallLocations[locationIdx]
-	rand.Shuffle(len(locationInfoCopy.Roles), func(i, j int) {
-		locationInfoCopy.Roles[i], locationInfoCopy.Roles[j] = locationInfoCopy.Roles[j], locationInfoCopy.Roles[i]
-	})
 
 	userIds := db.GetUsersInSession(sessionId)
 
@@ -79,7 +78,9 @@ func SendSpyfallLocationToAll(staticData *processing.StaticProccessStructs, sess
 		return false
 	}
 
-	spyIdx := rand.Intn(len(userIds))
+	// the spy has no role
+	roles := assignSpyfallRoles(locationInfoCopy.Roles, len(userIds)-1, randomShuffle)
+	spyIdx := randomIntn(len(userIds))
 
 	roleIdx := 0
 	for i, userId := range userIds {
@@ -88,10 +89,10 @@ func SendSpyfallLocationToAll(staticData *processing.StaticProccessStructs, sess
 		var theme string
 		if i == spyIdx {
 			theme = trans("spyfall_theme_spy")
-		} else if roleIdx < len(locationInfoCopy.Roles)-1 {
+		} else {
 			theme = trans("spyfall_theme", map[string]interface{}{
 				"Location": trans("spyfall_loc_" + locationInfoCopy.LocationId),
-				"Role":     trans("spyfall_role_" + locationInfoCopy.LocationId + "_" + locationInfoCopy.Roles[roleIdx]),
+				"Role":     trans("spyfall_role_" + locationInfoCopy.LocationId + "_" + roles[roleIdx]),
 			})
 			roleIdx += 1
 		}
@@ -100,12 +101,31 @@ func SendSpyfallLocationToAll(staticData *processing.StaticProccessStructs, sess
 		if isFound {
 			staticData.Chat.SendMessage(chatId, wrapIntoTelegramSpoiler(theme, trans), 0, true)
 		} else {
-			db.AddWebMessage(userId, theme, 10)
+			SendWebMessage(staticData, userId, theme)
 		}
 	}
+	AnnounceToGroup(staticData, sessionId, "group_round_started")
 	return true
 }
 
+// assignSpyfallRoles gives the shuffled roles of a location to the players, when there are more players than roles
+// the roles are given once again, the roles of the config are shared by the sessions so they are shuffled in a copy
+func assignSpyfallRoles(locationRoles []string, playersCount int, shuffle func(n int, swap func(i, j int))) (roles []string) {
+	shuffledRoles := append([]string(nil), locationRoles...)
+	shuffle(len(shuffledRoles), func(i, j int) {
+		shuffledRoles[i], shuffledRoles[j] = shuffledRoles[j], shuffledRoles[i]
+	})
+
+	roles = make([]string, playersCount)
+	if len(shuffledRoles) == 0 {
+		return
+	}
+	for i := range roles {
+		roles[i] = shuffledRoles[i%len(shuffledRoles)]
+	}
+	return
+}
+
 func getRuneIdx(text []rune, what string) int {
 	whatRunes := []rune(what)
 
@@ -152,7 +172,7 @@ func wrapIntoTelegramSpoiler(text string, trans i18n.TranslateFunc) string {
 }
 
 func SendSpyfallLocationsList(data *processing.ProcessData) {
-	config, configCastSuccess := data.Static.Config.(static.StaticConfiguration)
+	config, configCastSuccess := GetConfig(data.Static)
 
 	if !configCastSuccess {
 		log.Print("Config type is incorrect")
@@ -176,7 +196,7 @@ func GiveRandomNumbersToPlayers(staticData *processing.StaticProccessStructs, se
 		return
 	}
 
-	rand.Shuffle(len(userIds), func(i, j int) { userIds[i], userIds[j] = userIds[j], userIds[i] })
+	randomShuffle(len(userIds), func(i, j int) { userIds[i], userIds[j] = userIds[j], userIds[i] })
 	for i, userId := range userIds {
 		trans := FindTransFunction(userId, staticData)
 		theme := trans("player_number_msg", map[string]interface{}{
@@ -187,8 +207,9 @@ func GiveRandomNumbersToPlayers(staticData *processing.StaticProccessStructs, se
 		if isFound {
 			staticData.Chat.SendMessage(chatId, theme, 0, true)
 		} else {
-			db.AddWebMessage(userId, theme, 10)
+			SendWebMessage(staticData, userId, theme)
 		}
 	}
+	AnnounceToGroup(staticData, sessionId, "group_numbers_given")
 	return
 }
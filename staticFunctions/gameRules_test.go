@@ -0,0 +1,33 @@
+package staticFunctions
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func reverseShuffle(n int, swap func(i, j int)) {
+	for i := 0; i < n/2; i++ {
+		swap(i, n-1-i)
+	}
+}
+
+func TestSpyfallRolesForMorePlayersThanRoles(t *testing.T) {
+	assert := require.New(t)
+
+	locationRoles := []string{"captain", "copilot", "mechanic"}
+
+	// every player gets a role, the roles are given again only after all of them were given
+	roles := assignSpyfallRoles(locationRoles, 5, reverseShuffle)
+	assert.Equal([]string{"mechanic", "copilot", "captain", "mechanic", "copilot"}, roles)
+
+	// the roles of the config are shared by all the sessions
+	assert.Equal([]string{"captain", "copilot", "mechanic"}, locationRoles)
+}
+
+func TestSpyfallRolesForFewerPlayersThanRoles(t *testing.T) {
+	assert := require.New(t)
+
+	// the last role is given too
+	assert.Equal([]string{"captain", "copilot"}, assignSpyfallRoles([]string{"captain", "copilot"}, 2, func(int, func(i, j int)) {}))
+	assert.Equal([]string{""}, assignSpyfallRoles(nil, 1, reverseShuffle))
+}
@@ -0,0 +1,96 @@
+package staticFunctions
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"html"
+	"log"
+)
+
+// IsGroupChat tells if the chat is a group, Telegram gives negative ids to groups and positive ones to users
+func IsGroupChat(chatId int64) bool {
+	return chatId < 0
+}
+
+// CreateGroupSession starts a game in a group chat, the players join it with the button of the message sent to the group
+func CreateGroupSession(staticData *processing.StaticProccessStructs, groupChatId int64, langKey string) (sessionId int64) {
+	db := GetDb(staticData)
+	sessionId = db.CreateGroupSession(groupChatId, langKey)
+
+	trans := GetTranslator(staticData, langKey)
+	messageId := staticData.Chat.SendDialog(groupChatId, staticData.MakeDialogFn("gr", 0, trans, staticData, sessionId), 0)
+	db.SetGroupMessageId(sessionId, messageId)
+	return
+}
+
+// updateGroupDialog shows the current number of players in the message of the group
+func updateGroupDialog(staticData *processing.StaticProccessStructs, sessionId int64) {
+	groupChat, isFound := GetDb(staticData).GetSessionGroupChat(sessionId)
+	if !isFound || groupChat.MessageId == 0 {
+		return
+	}
+
+	trans := GetTranslator(staticData, groupChat.Language)
+	staticData.Chat.SendDialog(groupChat.ChatId, staticData.MakeDialogFn("gr", 0, trans, staticData, sessionId), groupChat.MessageId)
+}
+
+// AnnounceToGroup sends a public message to the group chat of the session, the sessions without a group are skipped
+func AnnounceToGroup(staticData *processing.StaticProccessStructs, sessionId int64, textId string) {
+	groupChat, isFound := GetDb(staticData).GetSessionGroupChat(sessionId)
+	if !isFound {
+		return
+	}
+
+	trans := GetTranslator(staticData, groupChat.Language)
+	staticData.Chat.SendMessage(groupChat.ChatId, trans(textId), 0, true)
+}
+
+// JoinGroupSession adds the player who pressed the button in the group, the secret messages go to the private chat,
+// so a player who never started the bot gets a link to start it instead
+func JoinGroupSession(data *processing.ProcessData, sessionId int64) {
+	db := GetDb(data.Static)
+
+	sessionToken, isSessionFound := db.GetTokenFromSessionId(sessionId)
+	groupChat, isGroupFound := db.GetSessionGroupChat(sessionId)
+	if !isSessionFound || !isGroupFound {
+		data.SendMessage(data.Trans("link_session_ended"), true)
+		return
+	}
+
+	// the session id of the button is trusted only if the button is on the message of this session,
+	// Telegram doesn't let the users send the data of the buttons that the message doesn't have
+	if data.AnsweredMessageId != groupChat.MessageId {
+		log.Printf("User %d tried to join group session %d from another message", data.ChatId, sessionId)
+		return
+	}
+
+	// Telegram doesn't let bots write to the users first
+	messageId := data.SendMessage(data.Trans("group_game_joining"), true)
+	if messageId == 0 {
+		groupTrans := GetTranslator(data.Static, groupChat.Language)
+		data.Static.Chat.SendMessage(groupChat.ChatId, groupTrans("group_start_bot_first", map[string]interface{}{
+			"Name": html.EscapeString(data.UserSystemName),
+			"Link": GetTelegramInviteLink(data.Static.BotName, "", sessionToken),
+		}), 0, true)
+		return
+	}
+
+	isSuccessful, isSessionFull := ConnectToSession(data, sessionToken)
+	if !isSuccessful {
+		if isSessionFull {
+			data.SendMessage(data.Trans("session_is_full"), true)
+		} else {
+			data.SendMessage(data.Trans("link_session_ended"), true)
+		}
+	}
+}
+
+// endGroupGame replaces the button to join in the group with a message that the game has ended
+func endGroupGame(staticData *processing.StaticProccessStructs, sessionId int64) {
+	groupChat, isFound := GetDb(staticData).GetSessionGroupChat(sessionId)
+	if !isFound || groupChat.MessageId == 0 {
+		return
+	}
+
+	trans := GetTranslator(staticData, groupChat.Language)
+	staticData.Chat.SendMessage(groupChat.ChatId, trans("group_game_ended"), groupChat.MessageId, true)
+}
@@ -0,0 +1,93 @@
+package staticFunctions
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
+	"html"
+	"strings"
+)
+
+// the callback data of the join buttons in the messages sent with inline queries, "/join <game type>-<session token>"
+const inlineJoinCommand = "/join "
+
+func getInlineAnswerer(staticData *processing.StaticProccessStructs) (answerer transport.InlineAnswerer, isFound bool) {
+	answerer, isFound = staticData.Chat.(transport.InlineAnswerer)
+	return
+}
+
+// AnswerInlineInviteQuery offers to send an invite to the current session of the user to any chat,
+// the users who are not in a session get no results
+func AnswerInlineInviteQuery(staticData *processing.StaticProccessStructs, queryId string, userChatId int64, userName string) {
+	answerer, isFound := getInlineAnswerer(staticData)
+	if !isFound {
+		return
+	}
+
+	articles := make([]transport.InlineArticle, 0, len(InviteGameTypes))
+
+	db := GetDb(staticData)
+	if userId, isUserFound := db.FindTelegramUserId(userChatId); isUserFound {
+		if sessionId, isInSession := db.GetUserSession(userId); isInSession {
+			if sessionToken, isTokenFound := db.GetTokenFromSessionId(sessionId); isTokenFound {
+				trans := FindTransFunction(userId, staticData)
+				participantsCount := db.GetUsersCountInSession(sessionId, false)
+				for _, gameType := range InviteGameTypes {
+					translationMap := map[string]interface{}{
+						"Game":         trans(GetGameNameTextId(gameType)),
+						"Name":         html.EscapeString(userName),
+						"Participants": participantsCount,
+					}
+					articles = append(articles, transport.InlineArticle{
+						Id:          gameType,
+						Title:       trans("invite_inline_title", translationMap),
+						Description: trans("invite_inline_description", translationMap),
+						Text:        trans("invite_inline_text", translationMap),
+						ButtonText:  trans("invite_inline_join"),
+						ButtonData:  inlineJoinCommand + gameType + "-" + sessionToken,
+					})
+				}
+			}
+		}
+	}
+
+	answerer.AnswerInlineQuery(queryId, articles)
+}
+
+// AnswerInlineJoinButton opens the chat with the bot that joins the game, the bot can't write to the users
+// who pressed the button before they start it, so the problems with the session are shown in an alert
+func AnswerInlineJoinButton(staticData *processing.StaticProccessStructs, queryId string, buttonData string, userLang string) {
+	answerer, isFound := getInlineAnswerer(staticData)
+	if !isFound {
+		return
+	}
+
+	trans := GetTranslator(staticData, userLang)
+
+	payload, isJoinButton := strings.CutPrefix(buttonData, inlineJoinCommand)
+	gameType, sessionToken, isValid := ParseStartPayload(payload)
+	if !isJoinButton || !isValid {
+		answerer.AnswerCallbackQuery(queryId, trans("link_malformed"), "")
+		return
+	}
+
+	sessionId, isSessionFound := GetDb(staticData).GetSessionIdFromToken(sessionToken)
+	if !isSessionFound {
+		answerer.AnswerCallbackQuery(queryId, trans("link_session_ended"), "")
+		return
+	}
+
+	if IsSessionFull(staticData, sessionId) {
+		answerer.AnswerCallbackQuery(queryId, trans("session_is_full"), "")
+		return
+	}
+
+	answerer.AnswerCallbackQuery(queryId, "", GetTelegramInviteLink(staticData.BotName, gameType, sessionToken))
+}
+
+// OnInlineInviteSent is called when the user sends an invite to a chat, sharing the game keeps the session alive
+func OnInlineInviteSent(staticData *processing.StaticProccessStructs, userChatId int64) {
+	db := GetDb(staticData)
+	if userId, isFound := db.FindTelegramUserId(userChatId); isFound {
+		db.MarkUserActive(userId)
+	}
+}
@@ -0,0 +1,29 @@
+package staticFunctions
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// the game rules take random numbers only from here, so the games can be reproduced in tests
+var gameRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+var gameRandomMutex sync.Mutex
+
+func SetGameRandomSeed(seed int64) {
+	gameRandomMutex.Lock()
+	defer gameRandomMutex.Unlock()
+	gameRandom = rand.New(rand.NewSource(seed))
+}
+
+func randomIntn(n int) int {
+	gameRandomMutex.Lock()
+	defer gameRandomMutex.Unlock()
+	return gameRandom.Intn(n)
+}
+
+func randomShuffle(n int, swap func(i, j int)) {
+	gameRandomMutex.Lock()
+	defer gameRandomMutex.Unlock()
+	gameRandom.Shuffle(n, swap)
+}
@@ -0,0 +1,157 @@
+package staticFunctions
+
+import (
+	"fmt"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/database"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/skip2/go-qrcode"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultMaxPlayersInSession = 50
+	// in pixels, big enough to be scanned from a phone screen
+	inviteQrCodeSize = 256
+)
+
+// InviteGameTypes are the games that can be chosen in the invite links, the web page shows only the controls of the game
+var InviteGameTypes = []string{"spyfall", "fake-artist"}
+
+var sessionTokenRegexp = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9_-]{%d}$`, database.SessionTokenLength))
+
+// CreateSession moves the user to a new session, the players of the previous one get updated dialogs
+func CreateSession(staticData *processing.StaticProccessStructs, userId int64) (sessionId int64) {
+	sessionId, previousSessionId, wasInSession := GetDb(staticData).CreateSession(userId)
+	if wasInSession {
+		UpdateSessionDialogs(previousSessionId, staticData)
+	}
+	return
+}
+
+// GetMaxPlayersInSession returns how many players, from Telegram and from the web, a session can have
+func GetMaxPlayersInSession(staticData *processing.StaticProccessStructs) int64 {
+	config, _ := GetConfig(staticData)
+	if config.MaxPlayersInSession <= 0 {
+		return defaultMaxPlayersInSession
+	}
+	return int64(config.MaxPlayersInSession)
+}
+
+// IsSessionFull tells if no more players can join the session, the joins themselves check it once again
+func IsSessionFull(staticData *processing.StaticProccessStructs, sessionId int64) bool {
+	return GetDb(staticData).GetUsersCountInSession(sessionId, false) >= GetMaxPlayersInSession(staticData)
+}
+
+// LeaveSession removes a Telegram user from the session and updates the dialogs of the players who stay
+func LeaveSession(staticData *processing.StaticProccessStructs, userId int64) (wasInSession bool) {
+	sessionId, wasInSession := GetDb(staticData).LeaveSession(userId)
+	if wasInSession {
+		UpdateSessionDialogs(sessionId, staticData)
+	}
+	return
+}
+
+// RemoveWebPlayer removes a web player completely, web players don't exist outside of a session
+func RemoveWebPlayer(staticData *processing.StaticProccessStructs, playerToken string, userId int64, sessionId int64) {
+	GetDb(staticData).RemoveWebUser(playerToken)
+	UpdateSessionDialogs(sessionId, staticData)
+	// other pages of the player should know that they left
+	NotifyWebPlayers(staticData, []int64{userId})
+}
+
+func GetInviteLink(config *static.StaticConfiguration, gameType string, sessionToken string) string {
+	return fmt.Sprintf("%s/invite/%s/%s", config.ShareWebAddress, gameType, sessionToken)
+}
+
+// GetTelegramBotLink opens the chat with the bot
+func GetTelegramBotLink(botName string) string {
+	return fmt.Sprintf("https://t.me/%s", botName)
+}
+
+// GetTelegramInviteLink opens the chat with the bot and joins the game, the start payload is "<game type>-<session token>"
+// or only the session token if gameType is empty
+func GetTelegramInviteLink(botName string, gameType string, sessionToken string) string {
+	payload := sessionToken
+	if gameType != "" {
+		payload = gameType + "-" + sessionToken
+	}
+	return fmt.Sprintf("%s?start=%s", GetTelegramBotLink(botName), payload)
+}
+
+// ParseStartPayload reads the payload of a /start deep link, the links shared before the game types were added
+// have only the session token and give an empty gameType, isValid is false if the link couldn't come from the bot.
+// The sessions have no game mode, so gameType only tells the joined player which game is played,
+// and the payload has no place for the role hints
+func ParseStartPayload(payload string) (gameType string, sessionToken string, isValid bool) {
+	for _, inviteGameType := range InviteGameTypes {
+		if token, hasGameType := strings.CutPrefix(payload, inviteGameType+"-"); hasGameType && sessionTokenRegexp.MatchString(token) {
+			return inviteGameType, token, true
+		}
+	}
+
+	if sessionTokenRegexp.MatchString(payload) {
+		return "", payload, true
+	}
+	return "", "", false
+}
+
+// GetGameNameTextId returns the id of the translated name of the game
+func GetGameNameTextId(gameType string) string {
+	if gameType == "fake-artist" {
+		return "invite_artist"
+	}
+	return "invite_spyfall"
+}
+
+// GetInviteQrCodePng draws the invite link without any third-party services, the PNG can be sent to Telegram or served from the web
+func GetInviteQrCodePng(config *static.StaticConfiguration, gameType string, sessionToken string) ([]byte, error) {
+	return qrcode.Encode(GetInviteLink(config, gameType, sessionToken), qrcode.Medium, inviteQrCodeSize)
+}
+
+// FindAvailableLanguage returns the key of the configured language that fits the requested one,
+// e.g. "ru" or "ru-RU" give "ru-ru"
+func FindAvailableLanguage(config *static.StaticConfiguration, lang string) (langKey string, isFound bool) {
+	lang = strings.ToLower(lang)
+	if lang == "" {
+		return
+	}
+
+	for _, langCode := range config.AvailableLanguages {
+		if strings.ToLower(langCode.Key) == lang {
+			return langCode.Key, true
+		}
+	}
+
+	// the browsers can send only the language without the region
+	baseLang, _, _ := strings.Cut(lang, "-")
+	for _, langCode := range config.AvailableLanguages {
+		if strings.HasPrefix(strings.ToLower(langCode.Key), baseLang) {
+			return langCode.Key, true
+		}
+	}
+	return
+}
+
+// ChangeUserLanguage sets one of the configured languages for a Telegram or a web user
+func ChangeUserLanguage(staticData *processing.StaticProccessStructs, userId int64, lang string) (isChanged bool) {
+	config, _ := GetConfig(staticData)
+	langKey, isFound := FindAvailableLanguage(&config, lang)
+	if !isFound {
+		return false
+	}
+
+	GetDb(staticData).SetUserLanguage(userId, langKey)
+	return true
+}
+
+// GetUserLanguageOrDefault returns the language the messages for the user are translated to
+func GetUserLanguageOrDefault(staticData *processing.StaticProccessStructs, userId int64) string {
+	config, _ := GetConfig(staticData)
+	langKey, isFound := FindAvailableLanguage(&config, GetDb(staticData).GetUserLanguage(userId))
+	if !isFound {
+		return config.DefaultLanguage
+	}
+	return langKey
+}
@@ -0,0 +1,109 @@
+package staticFunctions
+
+import (
+	"context"
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"log"
+	"time"
+)
+
+const defaultCleanupIntervalMinutes = 10
+
+func IsSessionCleanupEnabled(config *static.StaticConfiguration) bool {
+	return config.SessionIdleTimeoutMinutes > 0 || config.WebUserIdleTimeoutMinutes > 0
+}
+
+// RunSessionCleanup periodically removes abandoned sessions and web users until the context is canceled
+func RunSessionCleanup(ctx context.Context, staticData *processing.StaticProccessStructs) {
+	config, configCastSuccess := GetConfig(staticData)
+	if !configCastSuccess {
+		log.Print("Config type is incorrect")
+		return
+	}
+
+	interval := config.CleanupIntervalMinutes
+	if interval <= 0 {
+		interval = defaultCleanupIntervalMinutes
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			CleanupIdleSessions(staticData, now)
+		}
+	}
+}
+
+func CleanupIdleSessions(staticData *processing.StaticProccessStructs, now time.Time) {
+	db := GetDb(staticData)
+
+	config, configCastSuccess := GetConfig(staticData)
+	if !configCastSuccess {
+		log.Print("Config type is incorrect")
+		return
+	}
+
+	if config.WebUserIdleTimeoutMinutes > 0 {
+		idleSince := now.Add(-time.Duration(config.WebUserIdleTimeoutMinutes) * time.Minute).Unix()
+		affectedSessions := db.RemoveWebUsersIdleSince(idleSince)
+		for _, sessionId := range affectedSessions {
+			if db.DoesSessionExist(sessionId) {
+				UpdateSessionDialogs(sessionId, staticData)
+			}
+		}
+		if len(affectedSessions) > 0 {
+			log.Printf("Removed idle web users from %d sessions", len(affectedSessions))
+		}
+	}
+
+	if config.SessionIdleTimeoutMinutes > 0 {
+		idleSince := now.Add(-time.Duration(config.SessionIdleTimeoutMinutes) * time.Minute).Unix()
+		idleSessions := db.GetSessionsIdleSince(idleSince)
+		for _, sessionId := range idleSessions {
+			expireSession(staticData, sessionId)
+		}
+		if len(idleSessions) > 0 {
+			log.Printf("Expired %d idle sessions", len(idleSessions))
+		}
+	}
+
+	db.RemoveOrphanedRecords()
+}
+
+func expireSession(staticData *processing.StaticProccessStructs, sessionId int64) {
+	closeSession(staticData, sessionId, "session_expired")
+}
+
+// CloseSessionByAdmin ends a session for all its players, e.g. if it is used for spam
+func CloseSessionByAdmin(staticData *processing.StaticProccessStructs, sessionId int64) (wasClosed bool) {
+	if !GetDb(staticData).DoesSessionExist(sessionId) {
+		return false
+	}
+	closeSession(staticData, sessionId, "session_closed_by_admin")
+	return true
+}
+
+// closeSession removes the session and tells its players why
+func closeSession(staticData *processing.StaticProccessStructs, sessionId int64, textId string) {
+	db := GetDb(staticData)
+
+	users := db.GetUsersInSession(sessionId)
+	endGroupGame(staticData, sessionId)
+	db.RemoveSession(sessionId)
+	// the pages of the removed web players will find out that the game has ended
+	NotifyWebPlayers(staticData, users)
+
+	for _, userId := range users {
+		chatId, isFound := db.GetTelegramUserChatId(userId)
+		if isFound {
+			trans := FindTransFunction(userId, staticData)
+			staticData.Chat.SendMessage(chatId, trans(textId), 0, true)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
 	"github.com/gameraccoon/telegram-spy-game-bot/database"
 	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
 	"github.com/nicksnyder/go-i18n/i18n"
 	"log"
 	"strings"
@@ -25,6 +26,58 @@ func GetDb(staticData *processing.StaticProccessStructs) *database.SpyBotDb {
 	}
 }
 
+// SendPhoto returns zero if the chat can't send images or the sending failed
+func SendPhoto(staticData *processing.StaticProccessStructs, chatId int64, fileName string, image []byte, caption string) int64 {
+	photoSender, isPhotoSender := staticData.Chat.(transport.PhotoSender)
+	if !isPhotoSender {
+		return 0
+	}
+	return photoSender.SendPhoto(chatId, fileName, image, caption)
+}
+
+func GetConfig(staticData *processing.StaticProccessStructs) (config static.StaticConfiguration, isFound bool) {
+	storage, ok := staticData.Config.(*static.ConfigStorage)
+	if ok && storage != nil {
+		return storage.GetConfig(), true
+	}
+	return
+}
+
+func getTranslators(staticData *processing.StaticProccessStructs) map[string]i18n.TranslateFunc {
+	storage, ok := staticData.Config.(*static.ConfigStorage)
+	if ok && storage != nil {
+		return storage.GetTranslators()
+	}
+	return staticData.Trans
+}
+
+// GetTranslator returns the translator of a configured language, or of the default one if there is no such language
+func GetTranslator(staticData *processing.StaticProccessStructs, lang string) i18n.TranslateFunc {
+	config, _ := GetConfig(staticData)
+	translators := getTranslators(staticData)
+
+	if langKey, isFound := FindAvailableLanguage(&config, lang); isFound {
+		if trans, ok := translators[langKey]; ok {
+			return trans
+		}
+	}
+	return translators[config.DefaultLanguage]
+}
+
+func IsAdmin(staticData *processing.StaticProccessStructs, chatId int64) bool {
+	config, configCastSuccess := GetConfig(staticData)
+	if !configCastSuccess {
+		return false
+	}
+
+	for _, adminId := range config.AdminTelegramIds {
+		if adminId == chatId {
+			return true
+		}
+	}
+	return false
+}
+
 func getClosestLang(config *static.StaticConfiguration, lang string) string {
 	for _, langCode := range config.AvailableLanguages {
 		if strings.HasPrefix(langCode.Key, lang) {
@@ -38,11 +91,8 @@ func FindTransFunction(userId int64, staticData *processing.StaticProccessStruct
 	// ToDo: cache user's lang
 	lang := GetDb(staticData).GetUserLanguage(userId)
 
-	config, configCastSuccess := staticData.Config.(static.StaticConfiguration)
-
-	if !configCastSuccess {
-		config = static.StaticConfiguration{}
-	}
+	config, _ := GetConfig(staticData)
+	translators := getTranslators(staticData)
 
 	// replace empty language to default one (some clients don't send user's language)
 	if len(lang) <= 0 {
@@ -50,18 +100,18 @@ func FindTransFunction(userId int64, staticData *processing.StaticProccessStruct
 		lang = config.DefaultLanguage
 	}
 
-	if foundTrans, ok := staticData.Trans[lang]; ok {
+	if foundTrans, ok := translators[lang]; ok {
 		GetDb(staticData).SetUserLanguage(userId, lang)
 		return foundTrans
 	}
 
-	if foundTrans, ok := staticData.Trans[getClosestLang(&config, lang)]; ok {
+	if foundTrans, ok := translators[getClosestLang(&config, lang)]; ok {
 		GetDb(staticData).SetUserLanguage(userId, lang)
 		return foundTrans
 	}
 
 	// unknown language, use default instead
-	if foundTrans, ok := staticData.Trans[config.DefaultLanguage]; ok {
+	if foundTrans, ok := translators[config.DefaultLanguage]; ok {
 		log.Printf("User %d has unknown language (%s). Setting to default.", userId, lang)
 		lang = config.DefaultLanguage
 		GetDb(staticData).SetUserLanguage(userId, lang)
@@ -71,7 +121,7 @@ func FindTransFunction(userId int64, staticData *processing.StaticProccessStruct
 	// something gone wrong
 	log.Printf("Translator didn't found: %s", lang)
 	// fall to the first available translator
-	for lang, trans := range staticData.Trans {
+	for lang, trans := range translators {
 		log.Printf("Using first available translator: %s", lang)
 		return trans
 	}
@@ -113,18 +163,23 @@ func UpdateSessionDialogs(sessionId int64, staticData *processing.StaticProccess
 			}
 		}
 	}
+
+	updateGroupDialog(staticData, sessionId)
+
+	// the web players show the number of players
+	NotifyWebPlayers(staticData, users)
 }
 
-func ConnectToSession(data *processing.ProcessData, token string) (successful bool) {
+func ConnectToSession(data *processing.ProcessData, token string) (successful bool, isSessionFull bool) {
 	db := GetDb(data.Static)
 	sessionId, isFound := db.GetSessionIdFromToken(token)
 	if !isFound {
-		return false
+		return false, false
 	}
 
-	successfullyConnected, previousSessionId, wasInSession := db.ConnectToSession(data.UserId, sessionId)
+	successfullyConnected, isSessionFull, previousSessionId, wasInSession := db.ConnectToSessionIfNotFull(data.UserId, sessionId, GetMaxPlayersInSession(data.Static))
 	if !successfullyConnected {
-		return false
+		return false, isSessionFull
 	}
 
 	SendSessionDialog(data)
@@ -135,5 +190,5 @@ func ConnectToSession(data *processing.ProcessData, token string) (successful bo
 		UpdateSessionDialogs(previousSessionId, data.Static)
 	}
 
-	return true
+	return true, false
 }
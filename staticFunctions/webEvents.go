@@ -0,0 +1,39 @@
+package staticFunctions
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/processing"
+	"github.com/gameraccoon/telegram-spy-game-bot/webEvents"
+)
+
+const (
+	webEventsKey = "webEvents"
+	// how many recent messages are kept for a web player
+	webMessagesLimit = 10
+)
+
+func SetWebEventsBroker(staticData *processing.StaticProccessStructs, broker *webEvents.Broker) {
+	staticData.SetCustomValue(webEventsKey, broker)
+}
+
+// GetWebEventsBroker returns nil if the web pages are not notified about the changes
+func GetWebEventsBroker(staticData *processing.StaticProccessStructs) *webEvents.Broker {
+	broker, _ := staticData.GetCustomValue(webEventsKey).(*webEvents.Broker)
+	return broker
+}
+
+func NotifyWebPlayers(staticData *processing.StaticProccessStructs, userIds []int64) {
+	broker := GetWebEventsBroker(staticData)
+	if broker == nil {
+		return
+	}
+
+	for _, userId := range userIds {
+		broker.Publish(userId)
+	}
+}
+
+// SendWebMessage stores the message for a web player and wakes up their open page
+func SendWebMessage(staticData *processing.StaticProccessStructs, userId int64, message string) {
+	GetDb(staticData).AddWebMessage(userId, message, webMessagesLimit)
+	NotifyWebPlayers(staticData, []int64{userId})
+}
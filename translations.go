@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/nicksnyder/go-i18n/i18n"
+	"github.com/nicksnyder/go-i18n/i18n/bundle"
+	"path/filepath"
+	"strings"
+)
+
+// translationIds contains the sets of translated string ids for each language key
+type translationIds map[string]map[string]bool
+
+// loadTranslations loads every available language into a separate bundle,
+// languages that failed to load are reported and skipped
+func loadTranslations(languages []static.LanguageData, stringsDir string) (translators map[string]i18n.TranslateFunc, ids translationIds, problems []string) {
+	translators = make(map[string]i18n.TranslateFunc)
+	ids = make(translationIds)
+
+	translationBundle := bundle.New()
+
+	for _, lang := range languages {
+		path := filepath.Join(stringsDir, lang.Key+".all.json")
+		err := translationBundle.LoadTranslationFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("can't load translations for %s: %s", lang.Key, err.Error()))
+			continue
+		}
+
+		trans, err := translationBundle.Tfunc(lang.Key)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("can't make translator for %s: %s", lang.Key, err.Error()))
+			continue
+		}
+		translators[lang.Key] = i18n.TranslateFunc(trans)
+
+		// the bundle stores languages by normalized tags
+		langIds := make(map[string]bool)
+		for _, id := range translationBundle.LanguageTranslationIDs(strings.ToLower(lang.Key)) {
+			langIds[id] = true
+		}
+		ids[lang.Key] = langIds
+	}
+
+	return
+}
@@ -0,0 +1,298 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SimulatorHelp = `Simulator commands:
+  <user id> <text>      send a message or a command from a user, e.g. "1 /start"
+  <user id> !<button>   press a button of the last dialog sent to the user, e.g. "1 !2"
+  sleep <duration>      wait before reading the next line, e.g. "sleep 500ms"
+Users are created on their first message.`
+
+type simulatedButton struct {
+	text string
+	data string
+	url  string
+}
+
+type simulatedDialog struct {
+	messageId int64
+	buttons   []simulatedButton
+}
+
+// Simulator replaces Telegram with text: reads the actions of fake users from the input
+// and prints everything the bot sends to them to the output, so the bot can be run without a bot token
+type Simulator struct {
+	input       io.Reader
+	output      io.Writer
+	botUsername string
+	// protects everything below
+	mutex         sync.Mutex
+	lastMessageId int64
+	lastUpdateId  int
+	// the dialog whose buttons can be pressed, per chat
+	lastDialogs map[int64]simulatedDialog
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+func MakeSimulator(input io.Reader, output io.Writer, botUsername string) *Simulator {
+	return &Simulator{
+		input:       input,
+		output:      output,
+		botUsername: botUsername,
+		lastDialogs: make(map[int64]simulatedDialog),
+		stop:        make(chan struct{}),
+	}
+}
+
+func (simulator *Simulator) GetBotUsername() string {
+	return simulator.botUsername
+}
+
+func (simulator *Simulator) nextMessageIdUnsafe(messageToReplace int64) int64 {
+	if messageToReplace != 0 {
+		return messageToReplace
+	}
+	simulator.lastMessageId++
+	return simulator.lastMessageId
+}
+
+func formatMessageHeader(chatId int64, messageId int64, messageToReplace int64) string {
+	if messageToReplace != 0 {
+		return fmt.Sprintf("[to %d, #%d edited]", chatId, messageId)
+	}
+	return fmt.Sprintf("[to %d, #%d]", chatId, messageId)
+}
+
+func (simulator *Simulator) SendMessage(chatId int64, message string, messageToReplace int64, preventPreview bool) int64 {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	messageId := simulator.nextMessageIdUnsafe(messageToReplace)
+	fmt.Fprintf(simulator.output, "%s %s\n", formatMessageHeader(chatId, messageId, messageToReplace), message)
+	return messageId
+}
+
+func (simulator *Simulator) SendDialog(chatId int64, dialog *dialog.Dialog, messageToReplace int64) int64 {
+	if dialog == nil {
+		return 0
+	}
+
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	messageId := simulator.nextMessageIdUnsafe(messageToReplace)
+	fmt.Fprintf(simulator.output, "%s %s\n", formatMessageHeader(chatId, messageId, messageToReplace), dialog.Text)
+
+	sentDialog := simulatedDialog{messageId: messageId}
+	for i, variant := range dialog.Variants {
+		button := simulatedButton{
+			text: variant.Text,
+			url:  variant.Url,
+		}
+		if variant.Url == "" {
+			button.data = getCallbackData(dialog.Id, variant.Id, variant.AdditionalId)
+			fmt.Fprintf(simulator.output, "  !%d %s\n", i+1, variant.Text)
+		} else {
+			fmt.Fprintf(simulator.output, "  !%d %s (%s)\n", i+1, variant.Text, variant.Url)
+		}
+		sentDialog.buttons = append(sentDialog.buttons, button)
+	}
+	simulator.lastDialogs[chatId] = sentDialog
+
+	return messageId
+}
+
+// the text output can't show the image, only what was sent
+func (simulator *Simulator) SendPhoto(chatId int64, fileName string, image []byte, caption string) int64 {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	messageId := simulator.nextMessageIdUnsafe(0)
+	fmt.Fprintf(simulator.output, "%s [photo %s, %d bytes] %s\n", formatMessageHeader(chatId, messageId, 0), fileName, len(image), caption)
+	return messageId
+}
+
+// the simulated users can't send inline queries, the answers are printed for the completeness
+func (simulator *Simulator) AnswerInlineQuery(queryId string, articles []InlineArticle) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	fmt.Fprintf(simulator.output, "[inline query %s answered with %d results]\n", queryId, len(articles))
+	for _, article := range articles {
+		fmt.Fprintf(simulator.output, "  %s: %s (%s)\n", article.Id, article.Title, article.ButtonData)
+	}
+}
+
+func (simulator *Simulator) AnswerCallbackQuery(queryId string, text string, url string) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	fmt.Fprintf(simulator.output, "[callback %s answered] %s %s\n", queryId, text, url)
+}
+
+func (simulator *Simulator) RemoveMessage(chatId int64, messageId int64) {
+	if messageId == 0 {
+		return
+	}
+
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	if simulator.lastDialogs[chatId].messageId == messageId {
+		delete(simulator.lastDialogs, chatId)
+	}
+	fmt.Fprintf(simulator.output, "[to %d, #%d removed]\n", chatId, messageId)
+}
+
+// the same format that Telegram chat uses for the buttons
+func getCallbackData(dialogId string, variantId string, additionalId string) string {
+	if additionalId == "" {
+		return fmt.Sprintf("/%s_%s", dialogId, variantId)
+	}
+	return fmt.Sprintf("/%s_%s_%s", dialogId, variantId, additionalId)
+}
+
+func (simulator *Simulator) ReceiveUpdates() (<-chan tgbotapi.Update, error) {
+	updates := make(chan tgbotapi.Update)
+
+	go func() {
+		defer close(updates)
+
+		scanner := bufio.NewScanner(simulator.input)
+		for scanner.Scan() {
+			update, isUpdate, err := simulator.parseLine(strings.TrimSpace(scanner.Text()))
+			if err != nil {
+				simulator.printError(err)
+				continue
+			}
+			if !isUpdate {
+				continue
+			}
+
+			select {
+			case updates <- update:
+			case <-simulator.stop:
+				return
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+func (simulator *Simulator) StopReceivingUpdates() {
+	simulator.stopOnce.Do(func() {
+		close(simulator.stop)
+	})
+}
+
+func (simulator *Simulator) printError(err error) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+	fmt.Fprintf(simulator.output, "! %s\n", err.Error())
+}
+
+func (simulator *Simulator) parseLine(line string) (update tgbotapi.Update, isUpdate bool, err error) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	if duration, isSleep := strings.CutPrefix(line, "sleep "); isSleep {
+		var sleepTime time.Duration
+		sleepTime, err = time.ParseDuration(strings.TrimSpace(duration))
+		if err == nil {
+			time.Sleep(sleepTime)
+		}
+		return
+	}
+
+	userIdText, text, _ := strings.Cut(line, " ")
+	userId, err := strconv.Atoi(userIdText)
+	if err != nil || userId <= 0 {
+		err = fmt.Errorf("can't parse \"%s\", expected a positive user id at the beginning of the line", line)
+		return
+	}
+
+	if buttonText, isButton := strings.CutPrefix(text, "!"); isButton {
+		update, err = simulator.makeCallbackUpdate(userId, buttonText)
+	} else {
+		update = simulator.makeMessageUpdate(userId, text)
+	}
+	isUpdate = err == nil
+	return
+}
+
+func makeSimulatedUser(userId int) *tgbotapi.User {
+	return &tgbotapi.User{
+		ID:           userId,
+		FirstName:    fmt.Sprintf("User%d", userId),
+		LanguageCode: "en",
+	}
+}
+
+func (simulator *Simulator) makeMessageUpdate(userId int, text string) tgbotapi.Update {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	simulator.lastUpdateId++
+	simulator.lastMessageId++
+	return tgbotapi.Update{
+		UpdateID: simulator.lastUpdateId,
+		Message: &tgbotapi.Message{
+			MessageID: int(simulator.lastMessageId),
+			From:      makeSimulatedUser(userId),
+			Chat:      &tgbotapi.Chat{ID: int64(userId), Type: "private"},
+			Date:      int(time.Now().Unix()),
+			Text:      text,
+		},
+	}
+}
+
+func (simulator *Simulator) makeCallbackUpdate(userId int, buttonText string) (update tgbotapi.Update, err error) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	lastDialog, isFound := simulator.lastDialogs[int64(userId)]
+	if !isFound {
+		err = fmt.Errorf("user %d has no dialog with buttons", userId)
+		return
+	}
+
+	buttonIndex, err := strconv.Atoi(strings.TrimSpace(buttonText))
+	if err != nil || buttonIndex < 1 || buttonIndex > len(lastDialog.buttons) {
+		err = fmt.Errorf("the last dialog of user %d has buttons from 1 to %d", userId, len(lastDialog.buttons))
+		return
+	}
+
+	button := lastDialog.buttons[buttonIndex-1]
+	if button.url != "" {
+		err = fmt.Errorf("button %d opens %s, it can't be pressed in the simulator", buttonIndex, button.url)
+		return
+	}
+
+	simulator.lastUpdateId++
+	update = tgbotapi.Update{
+		UpdateID: simulator.lastUpdateId,
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   strconv.Itoa(simulator.lastUpdateId),
+			From: makeSimulatedUser(userId),
+			Message: &tgbotapi.Message{
+				MessageID: int(lastDialog.messageId),
+				Chat:      &tgbotapi.Chat{ID: int64(userId), Type: "private"},
+			},
+			Data: button.data,
+		},
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"bytes"
+	"github.com/gameraccoon/telegram-bot-skeleton/dialog"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSimulatorUpdates(t *testing.T) {
+	assert := require.New(t)
+
+	var output bytes.Buffer
+	input := strings.NewReader("1 /start\n\n# comment\n2 hello there\nwrong line\n1 !2\n")
+	simulator := MakeSimulator(input, &output, "test_bot")
+
+	testDialog := &dialog.Dialog{
+		Id:   "se",
+		Text: "Session",
+		Variants: []dialog.Variant{
+			{Id: "inv", Text: "Invite", Url: "https://example.com"},
+			{Id: "lv", AdditionalId: "12", Text: "Leave"},
+		},
+	}
+	dialogMessageId := simulator.SendDialog(1, testDialog, 0)
+
+	updates, err := simulator.ReceiveUpdates()
+	assert.NoError(err)
+
+	update := <-updates
+	assert.Equal("/start", update.Message.Text)
+	assert.Equal(int64(1), update.Message.Chat.ID)
+
+	update = <-updates
+	assert.Equal("hello there", update.Message.Text)
+	assert.Equal(2, update.Message.From.ID)
+
+	update = <-updates
+	assert.Equal("/se_lv_12", update.CallbackQuery.Data)
+	assert.Equal(int(dialogMessageId), update.CallbackQuery.Message.MessageID)
+
+	_, isOpen := <-updates
+	assert.False(isOpen)
+
+	assert.Contains(output.String(), "!1 Invite (https://example.com)")
+	assert.Contains(output.String(), "!2 Leave")
+	assert.Contains(output.String(), "positive user id")
+}
+
+func TestSimulatorButtons(t *testing.T) {
+	assert := require.New(t)
+
+	simulator := MakeSimulator(strings.NewReader(""), &bytes.Buffer{}, "test_bot")
+
+	_, _, err := simulator.parseLine("1 !1")
+	assert.ErrorContains(err, "no dialog")
+
+	messageId := simulator.SendDialog(1, &dialog.Dialog{Id: "ns", Variants: []dialog.Variant{{Id: "cr", Text: "Create"}}}, 0)
+	assert.Equal(messageId, simulator.SendMessage(1, "edited", messageId, true))
+
+	_, _, err = simulator.parseLine("1 !2")
+	assert.ErrorContains(err, "from 1 to 1")
+
+	_, isUpdate, err := simulator.parseLine("1 !1")
+	assert.NoError(err)
+	assert.True(isUpdate)
+
+	simulator.RemoveMessage(1, messageId)
+	_, _, err = simulator.parseLine("1 !1")
+	assert.ErrorContains(err, "no dialog")
+}
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"encoding/json"
+	"github.com/gameraccoon/telegram-bot-skeleton/telegramChat"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"log"
+	"net/url"
+)
+
+// TelegramTransport talks to the real Telegram API, the updates come from long polling or from the webhook
+type TelegramTransport struct {
+	*telegramChat.TelegramChat
+	webhookUpdates <-chan tgbotapi.Update
+}
+
+func MakeTelegramTransport(apiToken string) (*TelegramTransport, error) {
+	chat, err := telegramChat.MakeTelegramChat(apiToken)
+	if err != nil {
+		return nil, err
+	}
+	return &TelegramTransport{TelegramChat: chat}, nil
+}
+
+// SetWebhook registers the webhook in Telegram, the updates that Telegram sends to it should be passed to the channel
+func (transport *TelegramTransport) SetWebhook(webhookUrl string, secretToken string, updates <-chan tgbotapi.Update) error {
+	_, err := transport.GetBot().MakeRequest("setWebhook", url.Values{
+		"url":          {webhookUrl},
+		"secret_token": {secretToken},
+	})
+	if err == nil {
+		transport.webhookUpdates = updates
+	}
+	return err
+}
+
+// BotCommand is a command in the menu of the Telegram clients
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// SetCommands replaces the menu of the commands in the chats of the scope, e.g. "all_private_chats",
+// the list without a language code is shown to the users whose language has no list of its own
+func (transport *TelegramTransport) SetCommands(commands []BotCommand, scope string, languageCode string) error {
+	commandsJson, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+
+	scopeJson, err := json.Marshal(map[string]string{"type": scope})
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{
+		"commands": {string(commandsJson)},
+		"scope":    {string(scopeJson)},
+	}
+	if languageCode != "" {
+		params.Set("language_code", languageCode)
+	}
+
+	_, err = transport.GetBot().MakeRequest("setMyCommands", params)
+	return err
+}
+
+func (transport *TelegramTransport) SendPhoto(chatId int64, fileName string, image []byte, caption string) int64 {
+	photo := tgbotapi.NewPhotoUpload(chatId, tgbotapi.FileBytes{Name: fileName, Bytes: image})
+	photo.Caption = caption
+
+	sentMessage, err := transport.GetBot().Send(photo)
+	if err != nil {
+		log.Printf("Can't send photo: %s", err.Error())
+		return 0
+	}
+	return int64(sentMessage.MessageID)
+}
+
+func (transport *TelegramTransport) AnswerInlineQuery(queryId string, articles []InlineArticle) {
+	results := make([]interface{}, 0, len(articles))
+	for _, article := range articles {
+		result := tgbotapi.NewInlineQueryResultArticleHTML(article.Id, article.Title, article.Text)
+		result.Description = article.Description
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(article.ButtonText, article.ButtonData),
+		))
+		result.ReplyMarkup = &markup
+		results = append(results, result)
+	}
+
+	_, err := transport.GetBot().AnswerInlineQuery(tgbotapi.InlineConfig{
+		InlineQueryID: queryId,
+		Results:       results,
+		// the results depend on the current session of the user
+		IsPersonal: true,
+		CacheTime:  0,
+	})
+	if err != nil {
+		log.Printf("Can't answer inline query: %s", err.Error())
+	}
+}
+
+func (transport *TelegramTransport) AnswerCallbackQuery(queryId string, text string, url string) {
+	_, err := transport.GetBot().AnswerCallbackQuery(tgbotapi.CallbackConfig{
+		CallbackQueryID: queryId,
+		Text:            text,
+		ShowAlert:       text != "",
+		URL:             url,
+	})
+	if err != nil {
+		log.Printf("Can't answer callback query: %s", err.Error())
+	}
+}
+
+func (transport *TelegramTransport) ReceiveUpdates() (<-chan tgbotapi.Update, error) {
+	if transport.webhookUpdates != nil {
+		return transport.webhookUpdates, nil
+	}
+
+	// Telegram doesn't allow long polling while a webhook is set
+	_, err := transport.GetBot().RemoveWebhook()
+	if err != nil {
+		log.Printf("Can't remove webhook: %s", err.Error())
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	return transport.GetBot().GetUpdatesChan(u)
+}
+
+func (transport *TelegramTransport) StopReceivingUpdates() {
+	// the webhook stops receiving updates together with the HTTP server
+	if transport.webhookUpdates == nil {
+		transport.GetBot().StopReceivingUpdates()
+	}
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"github.com/gameraccoon/telegram-bot-skeleton/chat"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// PhotoSender sends images to the chats, e.g. the QR codes of the invite links
+type PhotoSender interface {
+	SendPhoto(chatId int64, fileName string, image []byte, caption string) int64
+}
+
+// InlineArticle is a result of an inline query, the message that the user sends with it has one button
+type InlineArticle struct {
+	Id          string
+	Title       string
+	Description string
+	// HTML, as the other messages
+	Text       string
+	ButtonText string
+	// the callback data of the button
+	ButtonData string
+}
+
+// InlineAnswerer answers the inline queries and the buttons of the messages sent with them,
+// the bot can't edit or reply to these messages since they are in the chats of other users
+type InlineAnswerer interface {
+	AnswerInlineQuery(queryId string, articles []InlineArticle)
+	// AnswerCallbackQuery shows the text to the user or opens the url, e.g. a t.me link that starts the bot
+	AnswerCallbackQuery(queryId string, text string, url string)
+}
+
+// Transport connects the bot to the users: receives their updates and sends them the messages,
+// the updates use the Telegram format whatever the real source is
+type Transport interface {
+	chat.Chat
+	PhotoSender
+	InlineAnswerer
+	GetBotUsername() string
+	// ReceiveUpdates starts receiving updates, the channel is closed if the source has no more updates
+	ReceiveUpdates() (<-chan tgbotapi.Update, error)
+	StopReceivingUpdates()
+}
@@ -1,58 +1,159 @@
 package main
 
 import (
+	"context"
 	"github.com/gameraccoon/telegram-bot-skeleton/dialogManager"
 	"github.com/gameraccoon/telegram-bot-skeleton/processing"
-	"github.com/gameraccoon/telegram-bot-skeleton/telegramChat"
+	"github.com/gameraccoon/telegram-spy-game-bot/staticFunctions"
+	"github.com/gameraccoon/telegram-spy-game-bot/transport"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
 	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type userChannel chan *processing.ProcessData
+const (
+	defaultUserWorkerIdleTimeout = 30 * time.Minute
+	idleWorkersCheckInterval     = time.Minute
+	defaultUserQueueSize         = 10
+)
+
+// userUpdate is either an update for the processors or an action that should be done in order with them
+type userUpdate struct {
+	data *processing.ProcessData
+	// the Telegram id of the sender of a group command, the sender's user is found by the worker of the group
+	senderChatId int64
+	// the updates that are not processed by the commands, e.g. the inline queries
+	action func()
+}
+
+type userChannel chan userUpdate
 
 type userChannelData struct {
+	// buffered, keeps the updates of the user in the order they were received
 	channel userChannel
 	// to be able to close old channels
 	lastUpdateTime time.Time
+	// to notify the user only once until the queue has free space again
+	isFloodNotified bool
+	// closed when the worker processed all its updates
+	finished chan struct{}
 }
 
 type userChannelsData map[int64]*userChannelData
 
-func startUpdating(chat *telegramChat.TelegramChat, dialogManager *dialogManager.DialogManager, staticData *processing.StaticProccessStructs) {
-	updateBot(chat, staticData, dialogManager)
+const workerStatsKey = "workerStats"
+
+type workerStats struct {
+	activeWorkers  atomic.Int64
+	startedWorkers atomic.Int64
+	evictedWorkers atomic.Int64
+	droppedUpdates atomic.Int64
 }
 
-func updateBot(chat *telegramChat.TelegramChat, staticData *processing.StaticProccessStructs, dialogManager *dialogManager.DialogManager) {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// updatesDispatcher passes updates to per-user workers, so updates of one user are processed one by one
+type updatesDispatcher struct {
+	userChans     userChannelsData
+	dialogManager *dialogManager.DialogManager
+	processors    *ProcessorFuncMap
+	// the commands that can be sent in group chats
+	groupProcessors *ProcessorFuncMap
+	staticData      *processing.StaticProccessStructs
+	// workers that were evicted but may still process their last update
+	stoppingWorkers map[int64]chan struct{}
+	workers         sync.WaitGroup
+	// messages about dropped updates that are being sent
+	floodNotices sync.WaitGroup
+	// shared with the admin commands
+	stats *workerStats
+}
 
-	updates, err := chat.GetBot().GetUpdatesChan(u)
+func makeUpdatesDispatcher(dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap, groupProcessors *ProcessorFuncMap, staticData *processing.StaticProccessStructs) *updatesDispatcher {
+	return &updatesDispatcher{
+		userChans:       make(userChannelsData),
+		dialogManager:   dialogManager,
+		processors:      processors,
+		groupProcessors: groupProcessors,
+		staticData:      staticData,
+		stoppingWorkers: make(map[int64]chan struct{}),
+		stats:           getWorkerStats(staticData),
+	}
+}
+
+// getWorkerStats returns the statistics stored by makeStaticData, the custom values can't be set
+// after the other goroutines have started
+func getWorkerStats(staticData *processing.StaticProccessStructs) *workerStats {
+	stats, ok := staticData.GetCustomValue(workerStatsKey).(*workerStats)
+	if !ok || stats == nil {
+		return &workerStats{}
+	}
+	return stats
+}
+
+// startUpdating processes the updates until the context is canceled or the transport has no more updates
+func startUpdating(ctx context.Context, botTransport transport.Transport, dialogManager *dialogManager.DialogManager, staticData *processing.StaticProccessStructs) {
+	updates, err := botTransport.ReceiveUpdates()
 
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	processors := makeUserCommandProcessors()
+	updateBot(ctx, updates, botTransport.StopReceivingUpdates, staticData, dialogManager)
+}
 
-	userChans := make(userChannelsData)
+func updateBot(ctx context.Context, updates <-chan tgbotapi.Update, stopReceivingUpdates func(), staticData *processing.StaticProccessStructs, dialogManager *dialogManager.DialogManager) {
+	processors := makeCommandProcessors()
+	groupProcessors := makeGroupCommandProcessors()
 
-	for update := range updates {
-		if update.Message != nil {
-			processMessageUpdate(userChans, &update, staticData, dialogManager, &processors)
-		}
-		if update.CallbackQuery != nil {
-			processCallbackUpdate(userChans, &update, staticData, dialogManager, &processors)
+	dispatcher := makeUpdatesDispatcher(dialogManager, &processors, &groupProcessors, staticData)
+
+	idleCheckTicker := time.NewTicker(idleWorkersCheckInterval)
+	defer idleCheckTicker.Stop()
+
+	for {
+		select {
+		case now := <-idleCheckTicker.C:
+			dispatcher.evictIdleWorkers(now.Add(-getUserWorkerIdleTimeout(staticData)))
+		case <-ctx.Done():
+			log.Print("Stop receiving updates")
+			stopReceivingUpdates()
+			dispatcher.drain()
+			return
+		case update, isOk := <-updates:
+			if !isOk {
+				log.Print("No more updates")
+				dispatcher.drain()
+				return
+			}
+			if update.Message != nil {
+				processMessageUpdate(dispatcher, &update, staticData)
+			}
+			if update.CallbackQuery != nil {
+				processCallbackUpdate(dispatcher, &update, staticData)
+			}
+			if update.InlineQuery != nil {
+				processInlineQueryUpdate(dispatcher, &update, staticData)
+			}
+			if update.ChosenInlineResult != nil {
+				processChosenInlineResultUpdate(dispatcher, &update, staticData)
+			}
 		}
 	}
 }
 
-func processMessageUpdate(userChans userChannelsData, update *tgbotapi.Update, staticData *processing.StaticProccessStructs, dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap) {
+func processMessageUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	if update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup() {
+		processGroupMessageUpdate(dispatcher, update, staticData)
+		return
+	}
+
 	data := processing.ProcessData{
 		Static:         staticData,
 		ChatId:         update.Message.Chat.ID,
 		UserSystemLang: strings.ToLower(update.Message.From.LanguageCode),
+		UserSystemName: update.Message.From.FirstName,
 	}
 
 	message := update.Message.Text
@@ -69,15 +170,60 @@ func processMessageUpdate(userChans userChannelsData, update *tgbotapi.Update, s
 		data.Message = message
 	}
 
-	processUpdate(userChans, &data, dialogManager, processors)
+	dispatcher.processUpdate(&data)
+}
+
+// parseGroupCommand returns the command without the parameters, in groups the commands can have
+// the name of the bot they are for, e.g. /newgame@SpyGameHelperBot
+func parseGroupCommand(message string, botName string) (command string, isForBot bool) {
+	if !strings.HasPrefix(message, "/") {
+		return "", false
+	}
+
+	command, _, _ = strings.Cut(message[1:], " ")
+	command, addressee, hasAddressee := strings.Cut(command, "@")
+	if hasAddressee && !strings.EqualFold(addressee, botName) {
+		return "", false
+	}
+	return command, command != ""
 }
 
-func processCallbackUpdate(userChans userChannelsData, update *tgbotapi.Update, staticData *processing.StaticProccessStructs, dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap) {
+// processGroupMessageUpdate passes only the commands for the bot, the updates of a group are processed by the worker of the group
+func processGroupMessageUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	if update.Message.From == nil {
+		return
+	}
+
+	command, isForBot := parseGroupCommand(update.Message.Text, staticData.BotName)
+	if !isForBot {
+		return
+	}
+
+	data := processing.ProcessData{
+		Static:         staticData,
+		ChatId:         update.Message.Chat.ID,
+		Command:        command,
+		UserSystemLang: strings.ToLower(update.Message.From.LanguageCode),
+		UserSystemName: update.Message.From.FirstName,
+	}
+
+	// the private chat with a user has the same id as the user
+	dispatcher.processGroupUpdate(&data, int64(update.Message.From.ID))
+}
+
+func processCallbackUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	// the buttons of the messages sent with inline queries are in the chats of other users, they have no message to answer to
+	if update.CallbackQuery.Message == nil {
+		processInlineCallbackUpdate(dispatcher, update, staticData)
+		return
+	}
+
 	data := processing.ProcessData{
 		Static:            staticData,
 		ChatId:            int64(update.CallbackQuery.From.ID),
 		AnsweredMessageId: int64(update.CallbackQuery.Message.MessageID),
 		UserSystemLang:    strings.ToLower(update.CallbackQuery.From.LanguageCode),
+		UserSystemName:    update.CallbackQuery.From.FirstName,
 	}
 
 	message := update.CallbackQuery.Data
@@ -90,42 +236,206 @@ func processCallbackUpdate(userChans userChannelsData, update *tgbotapi.Update,
 		data.Command = message[1:]
 	}
 
-	processUpdate(userChans, &data, dialogManager, processors)
+	dispatcher.processUpdate(&data)
 }
 
-func processUpdate(userChans userChannelsData, data *processing.ProcessData, dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap) {
-	userChanData, found := userChans[data.ChatId]
+// the inline updates are processed by the worker of the private chat of the user, the private chat has the same id as the user,
+// so the users who type fast can't start more work than their queue can hold
+func processInlineQueryUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	query := update.InlineQuery
+	dispatcher.processAction(int64(query.From.ID), func() {
+		staticFunctions.AnswerInlineInviteQuery(staticData, query.ID, int64(query.From.ID), query.From.FirstName)
+	})
+}
+
+func processInlineCallbackUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	callback := update.CallbackQuery
+	dispatcher.processAction(int64(callback.From.ID), func() {
+		staticFunctions.AnswerInlineJoinButton(staticData, callback.ID, callback.Data, callback.From.LanguageCode)
+	})
+}
+
+func processChosenInlineResultUpdate(dispatcher *updatesDispatcher, update *tgbotapi.Update, staticData *processing.StaticProccessStructs) {
+	userChatId := int64(update.ChosenInlineResult.From.ID)
+	dispatcher.processAction(userChatId, func() {
+		staticFunctions.OnInlineInviteSent(staticData, userChatId)
+	})
+}
+
+// processUpdate should be called from one goroutine only, the updates of a chat are processed in the order of the calls
+func (dispatcher *updatesDispatcher) processUpdate(data *processing.ProcessData) {
+	if !dispatcher.enqueue(data.ChatId, userUpdate{data: data}) {
+		dispatcher.notifyAboutFlood(data)
+	}
+}
+
+// processGroupUpdate is processUpdate for the commands sent in groups, the database is not touched here
+// since it would hold the updates of all the chats
+func (dispatcher *updatesDispatcher) processGroupUpdate(data *processing.ProcessData, senderChatId int64) {
+	if !dispatcher.enqueue(data.ChatId, userUpdate{data: data, senderChatId: senderChatId}) {
+		dispatcher.notifyAboutFlood(data)
+	}
+}
+
+// processAction does the action in the worker of the chat, the actions are dropped silently when the queue is full,
+// since they are not messages that the user expects an answer to
+func (dispatcher *updatesDispatcher) processAction(chatId int64, action func()) {
+	if !dispatcher.enqueue(chatId, userUpdate{action: action}) {
+		log.Printf("Queue of chat %d is full, dropping an inline update", chatId)
+	}
+}
+
+// enqueue passes the update to the worker of the chat, returns false when the update is dropped
+func (dispatcher *updatesDispatcher) enqueue(chatId int64, update userUpdate) (isQueued bool) {
+	userChanData, found := dispatcher.userChans[chatId]
 
 	if !found || userChanData == nil {
 		userChanData = &userChannelData{
-			channel: make(userChannel),
+			channel:  make(userChannel, getUserQueueSize(dispatcher.staticData)),
+			finished: make(chan struct{}),
 		}
-		userChans[data.ChatId] = userChanData
+		dispatcher.userChans[chatId] = userChanData
+
+		// the new worker should not overtake the evicted one that may still process the previous update
+		previousWorkerFinished := dispatcher.stoppingWorkers[chatId]
+		delete(dispatcher.stoppingWorkers, chatId)
 
 		// start updates for a user
-		go processUserUpdatesParallel(userChanData.channel, dialogManager, processors)
+		dispatcher.workers.Add(1)
+		dispatcher.stats.startedWorkers.Add(1)
+		dispatcher.stats.activeWorkers.Add(1)
+		go func() {
+			defer dispatcher.workers.Done()
+			defer dispatcher.stats.activeWorkers.Add(-1)
+			defer close(userChanData.finished)
+			if previousWorkerFinished != nil {
+				<-previousWorkerFinished
+			}
+			processUserUpdatesParallel(userChanData.channel, dispatcher.dialogManager, dispatcher.processors, dispatcher.groupProcessors)
+		}()
 	}
 
 	userChanData.lastUpdateTime = time.Now()
 
-	// send parallel to not to wait
-	go sendUpdate(userChanData.channel, data)
+	// never wait for a slow worker, otherwise one user could stop the bot for everyone
+	select {
+	case userChanData.channel <- update:
+		userChanData.isFloodNotified = false
+		return true
+	default:
+		dispatcher.stats.droppedUpdates.Add(1)
+		return false
+	}
+}
+
+// notifyAboutFlood tells the user once that the updates are dropped, until the queue has free space again
+func (dispatcher *updatesDispatcher) notifyAboutFlood(data *processing.ProcessData) {
+	userChanData, found := dispatcher.userChans[data.ChatId]
+	if !found || userChanData.isFloodNotified {
+		return
+	}
+
+	userChanData.isFloodNotified = true
+	log.Printf("Queue of chat %d is full, dropping updates", data.ChatId)
+	dispatcher.floodNotices.Add(1)
+	go func() {
+		defer dispatcher.floodNotices.Done()
+		sendFloodNotice(data)
+	}()
 }
 
-func sendUpdate(userChan userChannel, data *processing.ProcessData) {
-	userChan <- data
+func sendFloodNotice(data *processing.ProcessData) {
+	// the group is not spammed because of one member
+	if staticFunctions.IsGroupChat(data.ChatId) {
+		return
+	}
+
+	db := staticFunctions.GetDb(data.Static)
+	userId := db.GetOrCreateTelegramUserId(data.ChatId, data.UserSystemLang)
+	trans := staticFunctions.FindTransFunction(userId, data.Static)
+	data.Static.Chat.SendMessage(data.ChatId, trans("too_many_messages"), 0, true)
 }
 
-func processUserUpdatesParallel(userChan userChannel, dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap) {
+func getUserQueueSize(staticData *processing.StaticProccessStructs) int {
+	config, _ := staticFunctions.GetConfig(staticData)
+	if config.UserQueueSize > 0 {
+		return config.UserQueueSize
+	}
+	return defaultUserQueueSize
+}
+
+func getUserWorkerIdleTimeout(staticData *processing.StaticProccessStructs) time.Duration {
+	config, _ := staticFunctions.GetConfig(staticData)
+	if config.UserWorkerIdleTimeoutMinutes > 0 {
+		return time.Duration(config.UserWorkerIdleTimeoutMinutes) * time.Minute
+	}
+	return defaultUserWorkerIdleTimeout
+}
+
+// evictIdleWorkers stops workers of the chats that had no updates since the given time,
+// should be called from the same goroutine as processUpdate
+func (dispatcher *updatesDispatcher) evictIdleWorkers(idleSince time.Time) {
+	for chatId, finished := range dispatcher.stoppingWorkers {
+		select {
+		case <-finished:
+			delete(dispatcher.stoppingWorkers, chatId)
+		default:
+		}
+	}
+
+	evictedCount := 0
+	for chatId, userChanData := range dispatcher.userChans {
+		// updates are added only from this goroutine, so nothing can get into a closed channel,
+		// and the updates that are still in the queue will be processed before the worker stops
+		if userChanData.lastUpdateTime.Before(idleSince) {
+			close(userChanData.channel)
+			delete(dispatcher.userChans, chatId)
+			dispatcher.stoppingWorkers[chatId] = userChanData.finished
+			evictedCount++
+		}
+	}
+
+	if evictedCount > 0 {
+		dispatcher.stats.evictedWorkers.Add(int64(evictedCount))
+		log.Printf("Evicted %d idle user workers, active: %d, started in total: %d, evicted in total: %d, dropped updates: %d",
+			evictedCount,
+			dispatcher.stats.activeWorkers.Load(),
+			dispatcher.stats.startedWorkers.Load(),
+			dispatcher.stats.evictedWorkers.Load(),
+			dispatcher.stats.droppedUpdates.Load(),
+		)
+	}
+}
+
+// drain lets the workers finish all the received updates and stops them
+func (dispatcher *updatesDispatcher) drain() {
+	for chatId, userChanData := range dispatcher.userChans {
+		close(userChanData.channel)
+		delete(dispatcher.userChans, chatId)
+	}
+
+	dispatcher.workers.Wait()
+	dispatcher.floodNotices.Wait()
+	log.Print("All updates are processed")
+}
+
+func processUserUpdatesParallel(userChan userChannel, dialogManager *dialogManager.DialogManager, processors *ProcessorFuncMap, groupProcessors *ProcessorFuncMap) {
 	for {
-		updateData, chanIsOk := <-userChan
+		update, chanIsOk := <-userChan
 
 		if !chanIsOk {
-			log.Print("Close channel")
 			return
 		}
 
-		if len(updateData.Command) > 0 {
+		if update.action != nil {
+			update.action()
+			continue
+		}
+
+		updateData := update.data
+		if staticFunctions.IsGroupChat(updateData.ChatId) {
+			processGroupCommand(updateData, update.senderChatId, groupProcessors)
+		} else if len(updateData.Command) > 0 {
 			processCommand(updateData, dialogManager, processors)
 		} else {
 			processPlainMessage(updateData, dialogManager)
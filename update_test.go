@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInlineUpdatesAreLimitedByUserQueue(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	dispatcher := makeUpdatesDispatcher(makeDialogManager(), nil, nil, bot.staticData)
+
+	const chatId = int64(100)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var processedCount atomic.Int64
+
+	dispatcher.processAction(chatId, func() {
+		close(started)
+		<-unblock
+		processedCount.Add(1)
+	})
+	<-started
+
+	// the worker is busy, so only the queue can hold the next updates
+	for i := 0; i < defaultUserQueueSize+5; i++ {
+		dispatcher.processAction(chatId, func() {
+			processedCount.Add(1)
+		})
+	}
+	assert.Equal(int64(5), dispatcher.stats.droppedUpdates.Load())
+
+	close(unblock)
+	dispatcher.drain()
+	assert.Equal(int64(defaultUserQueueSize+1), processedCount.Load())
+	// the dropped inline updates are not answered with the messages about flood
+	assert.Empty(bot.chat.takeMessages(chatId))
+}
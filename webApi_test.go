@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"github.com/stretchr/testify/require"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testApiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type testMessagesResponse struct {
+	LastMessageIdx int      `json:"lastMessageIdx"`
+	Players        int64    `json:"players"`
+	Messages       []string `json:"messages"`
+}
+
+func startTestSession(bot *testBot, host int64) (sessionToken string) {
+	bot.sendText(host, "/session")
+	bot.pressButton(host, bot.chat.takeMessages(host), "createsess")
+	sessionId, _ := bot.db.GetUserSession(bot.getUserId(host))
+	sessionToken, _ = bot.db.GetTokenFromSessionId(sessionId)
+	return
+}
+
+func TestApiThemesAreNotBroken(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+	_, firstToken := bot.joinFromWeb(sessionToken)
+	_, secondToken := bot.joinFromWeb(sessionToken)
+
+	theme := "back\\slash \"quotes\" <b>tags</b>\nnew line\ttab \x01"
+	var okResponse struct {
+		Ok bool `json:"ok"`
+	}
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/theme", map[string]string{"playerToken": firstToken, "message": theme}, &okResponse))
+	assert.True(okResponse.Ok)
+
+	// one of the two other players gets the theme, the other one is the spy
+	var messages testMessagesResponse
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/messages?lastMessageIdx=-1", secondToken, &messages))
+	assert.Equal(int64(3), messages.Players)
+	assert.Equal(0, messages.LastMessageIdx)
+	assert.Len(messages.Messages, 1)
+
+	hostMessages := bot.chat.takeMessages(100)
+	if messages.Messages[0] == bot.trans("theme_spy") {
+		assert.Contains(hostMessages[len(hostMessages)-1].text, "back\\slash")
+	} else {
+		assert.Equal(theme, messages.Messages[0])
+	}
+
+	// nothing new since the last message
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/messages?lastMessageIdx=0", secondToken, &messages))
+	assert.NotNil(messages.Messages)
+	assert.Empty(messages.Messages)
+
+	// the token in the URL would stay in the logs of the proxies, it is not accepted
+	var apiErr testApiError
+	assert.Equal(http.StatusBadRequest, bot.callApi(http.MethodGet, "/api/v1/messages?lastMessageIdx=0&playerToken="+secondToken, nil, &apiErr))
+	assert.Equal("invalid_player_token", apiErr.Error.Code)
+}
+
+func TestApiErrors(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+
+	var apiErr testApiError
+	assert.Equal(http.StatusNotFound, bot.callApi(http.MethodPost, "/api/v1/join", map[string]string{"gameId": "nosuchgame"}, &apiErr))
+	assert.Equal("game_not_found", apiErr.Error.Code)
+	assert.NotEmpty(apiErr.Error.Message)
+
+	assert.Equal(http.StatusBadRequest, bot.callApi(http.MethodPost, "/api/v1/join", "not an object", &apiErr))
+	assert.Equal("invalid_request", apiErr.Error.Code)
+
+	assert.Equal(http.StatusMethodNotAllowed, bot.callApi(http.MethodGet, "/api/v1/join", nil, &apiErr))
+	assert.Equal("method_not_allowed", apiErr.Error.Code)
+
+	assert.Equal(http.StatusNotFound, bot.callApi(http.MethodGet, "/api/v1/nothing", nil, &apiErr))
+	assert.Equal("not_found", apiErr.Error.Code)
+
+	assert.Equal(http.StatusNotFound, bot.callApi(http.MethodPost, "/api/v1/spyfall", map[string]string{"playerToken": "12345"}, &apiErr))
+	assert.Equal("player_not_found", apiErr.Error.Code)
+
+	// only the host would get the theme, so nobody could be the spy
+	_, playerToken := bot.joinFromWeb(sessionToken)
+	assert.Equal(http.StatusConflict, bot.callApi(http.MethodPost, "/api/v1/theme", map[string]string{"playerToken": playerToken, "message": "theme"}, &apiErr))
+	assert.Equal("not_enough_players", apiErr.Error.Code)
+
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/leave", map[string]string{"playerToken": playerToken}, nil))
+	assert.Equal(http.StatusNotFound, bot.getApiAsPlayer("/api/v1/messages?lastMessageIdx=-1", playerToken, &apiErr))
+	assert.Equal("player_not_found", apiErr.Error.Code)
+}
+
+func TestApiServesSpec(t *testing.T) {
+	bot := startTestBot(t, 1)
+
+	var spec struct {
+		OpenApi string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	require.Equal(t, http.StatusOK, bot.callApi(http.MethodGet, "/api/v1/openapi.json", nil, &spec))
+	require.Equal(t, "3.0.3", spec.OpenApi)
+	for _, path := range []string{"/create", "/join", "/session", "/language", "/messages", "/theme", "/spyfall", "/numbers", "/leave"} {
+		require.Contains(t, spec.Paths, path)
+	}
+}
+
+type testEvent struct {
+	name string
+	id   string
+	data string
+}
+
+func readTestEvent(t *testing.T, reader *bufio.Reader) (event testEvent) {
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" {
+			if event.name != "" {
+				return
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "event":
+			event.name = value
+		case "id":
+			event.id = value
+		case "data":
+			event.data = value
+		}
+	}
+}
+
+func TestApiEventStream(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+	_, playerToken := bot.joinFromWeb(sessionToken)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, bot.webServer.URL+"/api/v1/events?lastMessageIdx=-1", nil)
+	assert.NoError(err)
+	request.Header.Set("X-Player-Token", playerToken)
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(err)
+	defer response.Body.Close()
+	assert.Equal("text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+
+	// the current state comes right away
+	var messages testMessagesResponse
+	event := readTestEvent(t, reader)
+	assert.Equal("messages", event.name)
+	assert.NoError(json.Unmarshal([]byte(event.data), &messages))
+	assert.Equal(int64(2), messages.Players)
+	assert.Empty(messages.Messages)
+
+	// a new location is pushed without asking
+	bot.sendText(100, "/spyfall_send")
+	event = readTestEvent(t, reader)
+	assert.Equal("messages", event.name)
+	assert.Equal("0", event.id)
+	assert.NoError(json.Unmarshal([]byte(event.data), &messages))
+	assert.Len(messages.Messages, 1)
+	assert.Equal(0, messages.LastMessageIdx)
+
+	// the number of players changes when someone joins
+	bot.joinFromWeb(sessionToken)
+	event = readTestEvent(t, reader)
+	assert.NoError(json.Unmarshal([]byte(event.data), &messages))
+	assert.Equal(int64(3), messages.Players)
+	assert.Empty(messages.Messages)
+
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/leave", map[string]string{"playerToken": playerToken}, nil))
+	assert.Equal("ended", readTestEvent(t, reader).name)
+}
+
+type testSessionResponse struct {
+	GameId       string `json:"gameId"`
+	IsWebHosted  bool   `json:"isWebHosted"`
+	Participants []struct {
+		Platform string `json:"platform"`
+		IsYou    bool   `json:"isYou"`
+	} `json:"participants"`
+	Invites []struct {
+		GameType  string `json:"gameType"`
+		Link      string `json:"link"`
+		QrCodeUrl string `json:"qrCodeUrl"`
+	} `json:"invites"`
+	Language string `json:"language"`
+}
+
+func TestApiWebHostedGame(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	var created struct {
+		PlayerToken string `json:"playerToken"`
+		GameId      string `json:"gameId"`
+	}
+	// the browsers send only the language without the region sometimes
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/create", map[string]string{"language": "ru"}, &created))
+	assert.NotEmpty(created.GameId)
+
+	var session testSessionResponse
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/session", created.PlayerToken, &session))
+	assert.Equal(created.GameId, session.GameId)
+	assert.True(session.IsWebHosted)
+	assert.Equal("ru-ru", session.Language)
+	assert.Len(session.Participants, 1)
+	assert.True(session.Participants[0].IsYou)
+	assert.Len(session.Invites, 2)
+	assert.Equal("https://example.com/invite/spyfall/"+created.GameId, session.Invites[0].Link)
+	assert.NotEmpty(session.Invites[0].QrCodeUrl)
+
+	// the others join the same way as to a game created in Telegram
+	_, secondToken := bot.joinFromWeb(created.GameId)
+	bot.sendText(100, "/start "+created.GameId)
+
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/session", secondToken, &session))
+	assert.Equal("en-us", session.Language)
+	assert.Len(session.Participants, 3)
+	assert.Equal("web", session.Participants[0].Platform)
+	assert.False(session.Participants[0].IsYou)
+	assert.True(session.Participants[1].IsYou)
+	assert.Equal("telegram", session.Participants[2].Platform)
+
+	var apiErr testApiError
+	assert.Equal(http.StatusBadRequest, bot.callApi(http.MethodPost, "/api/v1/language", map[string]string{"playerToken": secondToken, "language": "xx"}, &apiErr))
+	assert.Equal("invalid_language", apiErr.Error.Code)
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/language", map[string]string{"playerToken": secondToken, "language": "ru-RU"}, nil))
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/session", secondToken, &session))
+	assert.Equal("ru-ru", session.Language)
+
+	// the web players can start the rounds without a Telegram host
+	bot.chat.takeMessages(100)
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/spyfall", map[string]string{"playerToken": created.PlayerToken}, nil))
+	assert.Len(bot.chat.takeMessages(100), 1)
+
+	// the session doesn't depend on the Telegram players
+	bot.sendText(100, "/session")
+	bot.pressButton(100, bot.chat.takeMessages(100), "discsess")
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/session", created.PlayerToken, &session))
+	assert.Len(session.Participants, 2)
+
+	// and ends when the last player leaves
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/leave", map[string]string{"playerToken": created.PlayerToken}, nil))
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/leave", map[string]string{"playerToken": secondToken}, nil))
+	_, isFound := bot.db.GetSessionIdFromToken(created.GameId)
+	assert.False(isFound)
+}
+
+func TestApiPlayerCookie(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+
+	jar, err := cookiejar.New(nil)
+	assert.NoError(err)
+	// the redirects are checked by hand
+	browser := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	response, err := browser.Post(bot.webServer.URL+"/api/v1/join", "application/json", strings.NewReader(`{"gameId":"`+sessionToken+`"}`))
+	assert.NoError(err)
+	var joined struct {
+		PlayerToken string `json:"playerToken"`
+	}
+	assert.NoError(json.NewDecoder(response.Body).Decode(&joined))
+	response.Body.Close()
+	assert.Len(joined.PlayerToken, 43)
+
+	cookies := response.Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(joined.PlayerToken, cookies[0].Value)
+	assert.True(cookies[0].HttpOnly)
+
+	// the pages don't pass the token themselves
+	response, err = browser.Get(bot.webServer.URL + "/api/v1/session")
+	assert.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+
+	response, err = browser.Get(bot.webServer.URL + "/user/spyfall")
+	assert.NoError(err)
+	page, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(err)
+	assert.Contains(string(page), "leave-game-button")
+
+	// the old links with the token in the path are not used anymore
+	response, err = browser.Get(bot.webServer.URL + "/user/spyfall/" + joined.PlayerToken)
+	assert.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusSeeOther, response.StatusCode)
+	assert.Equal("/user/spyfall", response.Header.Get("Location"))
+
+	// the page passes the token that other sites can't read
+	csrfMatch := regexp.MustCompile(`'X-CSRF-Token': "([^"]+)"`).FindStringSubmatch(string(page))
+	assert.Len(csrfMatch, 2)
+
+	var apiErr testApiError
+	response, err = browser.Post(bot.webServer.URL+"/api/v1/leave", "application/json", strings.NewReader(`{}`))
+	assert.NoError(err)
+	assert.NoError(json.NewDecoder(response.Body).Decode(&apiErr))
+	response.Body.Close()
+	assert.Equal(http.StatusForbidden, response.StatusCode)
+	assert.Equal("csrf_token_mismatch", apiErr.Error.Code)
+
+	request, err := http.NewRequest(http.MethodPost, bot.webServer.URL+"/api/v1/leave", strings.NewReader(`{}`))
+	assert.NoError(err)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-CSRF-Token", csrfMatch[1])
+	response, err = browser.Do(request)
+	assert.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+
+	response, err = browser.Get(bot.webServer.URL + "/user/spyfall")
+	assert.NoError(err)
+	page, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(err)
+	assert.NotContains(string(page), "leave-game-button")
+}
+
+func (bot *testBot) changeConfig(change func(config *static.StaticConfiguration)) {
+	storage := bot.staticData.Config.(*static.ConfigStorage)
+	config := storage.GetConfig()
+	change(&config)
+	storage.Set(config, storage.GetTranslators())
+}
+
+func TestApiLimits(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+	bot.changeConfig(func(config *static.StaticConfiguration) {
+		config.MaxPlayersInSession = 3
+		config.MaxThemeLength = 5
+	})
+
+	sessionToken := startTestSession(bot, 100)
+	_, playerToken := bot.joinFromWeb(sessionToken)
+	bot.joinFromWeb(sessionToken)
+
+	var apiErr testApiError
+	assert.Equal(http.StatusConflict, bot.callApi(http.MethodPost, "/api/v1/join", map[string]string{"gameId": sessionToken}, &apiErr))
+	assert.Equal("session_full", apiErr.Error.Code)
+
+	// Telegram players can't join either
+	bot.sendText(101, "/start "+sessionToken)
+	assert.Equal(bot.trans("session_is_full"), bot.chat.takeMessages(101)[0].text)
+	_, isInSession := bot.db.GetUserSession(bot.getUserId(101))
+	assert.False(isInSession)
+
+	// the length is in characters, not in bytes
+	var okResponse struct {
+		Ok bool `json:"ok"`
+	}
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/theme", map[string]string{"playerToken": playerToken, "message": "тема"}, &okResponse))
+	assert.Equal(http.StatusBadRequest, bot.callApi(http.MethodPost, "/api/v1/theme", map[string]string{"playerToken": playerToken, "message": "theme1"}, &apiErr))
+	assert.Equal("message_too_long", apiErr.Error.Code)
+
+	assert.Equal(http.StatusRequestEntityTooLarge, bot.callApi(http.MethodPost, "/api/v1/theme", map[string]string{"playerToken": playerToken, "message": strings.Repeat("a", 100*1024)}, &apiErr))
+	assert.Equal("request_too_large", apiErr.Error.Code)
+}
+
+func TestConcurrentJoinsDontExceedPlayersLimit(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+	const maxPlayers = 5
+	bot.changeConfig(func(config *static.StaticConfiguration) {
+		config.MaxPlayersInSession = maxPlayers
+		config.JoinsPerMinutePerIp = 100
+		config.JoinsPerMinutePerSession = 100
+	})
+
+	sessionToken := startTestSession(bot, 100)
+	sessionId, _ := bot.db.GetSessionIdFromToken(sessionToken)
+
+	const joinsCount = 20
+	statuses := make(chan int, joinsCount)
+	var joins sync.WaitGroup
+	for i := 0; i < joinsCount; i++ {
+		joins.Add(1)
+		go func() {
+			defer joins.Done()
+			response, err := http.Post(bot.webServer.URL+"/api/v1/join", "application/json", strings.NewReader(`{"gameId": "`+sessionToken+`"}`))
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			response.Body.Close()
+			statuses <- response.StatusCode
+		}()
+	}
+	joins.Wait()
+	close(statuses)
+
+	joinedCount := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			joinedCount++
+		} else {
+			assert.Equal(http.StatusConflict, status)
+		}
+	}
+	// the host is one of the players
+	assert.Equal(maxPlayers-1, joinedCount)
+	assert.Equal(int64(maxPlayers), bot.db.GetUsersCountInSession(sessionId, false))
+}
+
+func TestApiRateLimits(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+	bot.changeConfig(func(config *static.StaticConfiguration) {
+		config.JoinsPerMinutePerIp = 2
+		config.ApiRequestsPerMinutePerIp = 5
+	})
+
+	var apiErr testApiError
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/create", map[string]string{}, nil))
+	assert.Equal(http.StatusOK, bot.callApi(http.MethodPost, "/api/v1/create", map[string]string{}, nil))
+	assert.Equal(http.StatusTooManyRequests, bot.callApi(http.MethodPost, "/api/v1/create", map[string]string{}, &apiErr))
+	assert.Equal("too_many_requests", apiErr.Error.Code)
+
+	// all the endpoints count for the address
+	assert.Equal(http.StatusNotFound, bot.callApi(http.MethodGet, "/api/v1/nothing", nil, nil))
+	assert.Equal(http.StatusNotFound, bot.callApi(http.MethodGet, "/api/v1/nothing", nil, nil))
+	assert.Equal(http.StatusTooManyRequests, bot.callApi(http.MethodGet, "/api/v1/nothing", nil, &apiErr))
+	assert.Equal("too_many_requests", apiErr.Error.Code)
+
+	// and so do the QR codes that take time to be encoded
+	response, err := http.Get(bot.webServer.URL + "/qr/unknown.png")
+	assert.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusTooManyRequests, response.StatusCode)
+	assert.NotEmpty(response.Header.Get("Retry-After"))
+}
+
+func TestInviteQrCode(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+
+	// Telegram players get the image itself
+	bot.sendText(100, "/session")
+	bot.pressButton(100, bot.chat.takeMessages(100), "share")
+	bot.pressButton(100, bot.chat.takeMessages(100), "spyfall")
+	messages := bot.chat.takeMessages(100)
+	assert.NotEmpty(messages)
+	qrCode := messages[len(messages)-1].image
+	_, err := png.Decode(bytes.NewReader(qrCode))
+	assert.NoError(err)
+
+	// the web page gets it from the bot too
+	_, playerToken := bot.joinFromWeb(sessionToken)
+	var session testSessionResponse
+	assert.Equal(http.StatusOK, bot.getApiAsPlayer("/api/v1/session", playerToken, &session))
+	assert.Equal("/qr/"+sessionToken+".png?game=spyfall", session.Invites[0].QrCodeUrl)
+
+	response, err := http.Get(bot.webServer.URL + session.Invites[0].QrCodeUrl)
+	assert.NoError(err)
+	defer response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal("image/png", response.Header.Get("Content-Type"))
+	image, err := io.ReadAll(response.Body)
+	assert.NoError(err)
+	assert.Equal(qrCode, image)
+
+	for path, status := range map[string]int{
+		"/qr/unknown.png":                         http.StatusNotFound,
+		"/qr/" + sessionToken:                     http.StatusNotFound,
+		"/qr/" + sessionToken + ".png?game=poker": http.StatusBadRequest,
+	} {
+		response, err := http.Get(bot.webServer.URL + path)
+		assert.NoError(err)
+		response.Body.Close()
+		assert.Equal(status, response.StatusCode, path)
+	}
+}
+
+func TestTelegramInviteLink(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	sessionToken := startTestSession(bot, 100)
+	telegramLink := "https://t.me/test_bot?start=fake-artist-" + sessionToken
+
+	bot.sendText(100, "/session")
+	bot.pressButton(100, bot.chat.takeMessages(100), "share")
+	bot.pressButton(100, bot.chat.takeMessages(100), "artist")
+	var texts []string
+	for _, message := range bot.chat.takeMessages(100) {
+		texts = append(texts, message.text)
+	}
+	assert.Contains(texts, bot.trans("invite_telegram_link", map[string]interface{}{"Link": telegramLink}))
+
+	// the invite page opens the same link
+	response, page := getTestPage(assert, http.DefaultClient, bot.webServer.URL+"/invite/fake-artist/"+sessionToken, "")
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Contains(page, telegramLink)
+
+	response, _ = getTestPage(assert, http.DefaultClient, bot.webServer.URL+"/invite/poker/"+sessionToken, "")
+	assert.Equal(http.StatusBadRequest, response.StatusCode)
+
+	bot.sendText(101, "/start fake-artist-"+sessionToken)
+	joinedSessionId, isInSession := bot.db.GetUserSession(bot.getUserId(101))
+	assert.True(isInSession)
+	sessionId, _ := bot.db.GetSessionIdFromToken(sessionToken)
+	assert.Equal(sessionId, joinedSessionId)
+	messages := bot.chat.takeMessages(101)
+	assert.Equal(bot.trans("link_joined_game", map[string]interface{}{"Game": bot.trans("invite_artist")}), messages[len(messages)-1].text)
+}
+
+func getTestPage(assert *require.Assertions, browser *http.Client, url string, acceptLanguage string) (response *http.Response, page string) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(err)
+	request.Header.Set("Accept-Language", acceptLanguage)
+
+	response, err = browser.Do(request)
+	assert.NoError(err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(err)
+	return response, string(body)
+}
+
+func TestLocalizedPages(t *testing.T) {
+	assert := require.New(t)
+	bot := startTestBot(t, 1)
+
+	jar, err := cookiejar.New(nil)
+	assert.NoError(err)
+	browser := &http.Client{Jar: jar}
+
+	// the language from the browser settings
+	response, page := getTestPage(assert, browser, bot.webServer.URL+"/", "de-DE,ru;q=0.9,en;q=0.8")
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal("ru-ru", response.Header.Get("Content-Language"))
+	assert.Contains(page, `<html lang="ru-ru">`)
+	assert.Contains(page, "Новая игра в Находку для шпиона")
+
+	_, page = getTestPage(assert, browser, bot.webServer.URL+"/invite/spyfall/unknown", "ru")
+	assert.Contains(page, "Игры, к которой вы пытаетесь присоединиться, не существует.")
+
+	// the chosen language is remembered
+	_, page = getTestPage(assert, browser, bot.webServer.URL+"/?lang=en-us", "ru")
+	assert.Contains(page, "New Spyfall game")
+	_, page = getTestPage(assert, browser, bot.webServer.URL+"/", "ru")
+	assert.Contains(page, "New Spyfall game")
+
+	// the game page is in the language of the game messages
+	sessionToken := startTestSession(bot, 100)
+	response, err = browser.Post(bot.webServer.URL+"/api/v1/join", "application/json", strings.NewReader(`{"gameId":"`+sessionToken+`","language":"ru-ru"}`))
+	assert.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+
+	_, page = getTestPage(assert, browser, bot.webServer.URL+"/user/spyfall", "en")
+	assert.Contains(page, "Пригласить игроков")
+	assert.Contains(page, "<td>Самолет</td><td>Банк</td>")
+
+	// the errors too, without the chosen language
+	response, page = getTestPage(assert, http.DefaultClient, bot.webServer.URL+"/invite/spyfall", "ru")
+	assert.Equal(http.StatusBadRequest, response.StatusCode)
+	assert.Contains(page, "Неправильный формат адреса")
+}
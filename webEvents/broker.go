@@ -0,0 +1,85 @@
+package webEvents
+
+import (
+	"sync"
+)
+
+// Broker tells the open web pages that something has changed for their players,
+// so the pages don't need to poll the database
+type Broker struct {
+	mutex       sync.Mutex
+	subscribers map[int64]map[chan struct{}]bool
+	stopped     chan struct{}
+	stopOnce    sync.Once
+}
+
+func MakeBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[int64]map[chan struct{}]bool),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel that gets a signal after changes for the user,
+// several changes can come as one signal if the reader is slower than the changes
+func (broker *Broker) Subscribe(userId int64) (signals <-chan struct{}, unsubscribe func()) {
+	signalsChan := make(chan struct{}, 1)
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	userSubscribers, isFound := broker.subscribers[userId]
+	if !isFound {
+		userSubscribers = make(map[chan struct{}]bool)
+		broker.subscribers[userId] = userSubscribers
+	}
+	userSubscribers[signalsChan] = true
+
+	unsubscribe = func() {
+		broker.mutex.Lock()
+		defer broker.mutex.Unlock()
+
+		currentSubscribers := broker.subscribers[userId]
+		delete(currentSubscribers, signalsChan)
+		if len(currentSubscribers) == 0 {
+			delete(broker.subscribers, userId)
+		}
+	}
+
+	return signalsChan, unsubscribe
+}
+
+// Publish never blocks, it is called while processing the game actions
+func (broker *Broker) Publish(userId int64) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for signalsChan := range broker.subscribers[userId] {
+		select {
+		case signalsChan <- struct{}{}:
+		default:
+			// the previous signal is not read yet, it covers this change too
+		}
+	}
+}
+
+// Stopped is closed when the subscribers should stop listening
+func (broker *Broker) Stopped() <-chan struct{} {
+	return broker.stopped
+}
+
+func (broker *Broker) Stop() {
+	broker.stopOnce.Do(func() {
+		close(broker.stopped)
+	})
+}
+
+func (broker *Broker) GetSubscribersCount() (count int) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for _, userSubscribers := range broker.subscribers {
+		count += len(userSubscribers)
+	}
+	return
+}
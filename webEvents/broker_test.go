@@ -0,0 +1,67 @@
+package webEvents
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func isSignaled(signals <-chan struct{}) bool {
+	select {
+	case <-signals:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBrokerSignals(t *testing.T) {
+	assert := require.New(t)
+	broker := MakeBroker()
+
+	first, unsubscribeFirst := broker.Subscribe(1)
+	second, unsubscribeSecond := broker.Subscribe(1)
+	other, unsubscribeOther := broker.Subscribe(2)
+	assert.Equal(3, broker.GetSubscribersCount())
+
+	// changes that were not read yet are merged and don't block
+	broker.Publish(1)
+	broker.Publish(1)
+	assert.True(isSignaled(first))
+	assert.False(isSignaled(first))
+	assert.True(isSignaled(second))
+	assert.False(isSignaled(other))
+
+	unsubscribeFirst()
+	broker.Publish(1)
+	assert.False(isSignaled(first))
+	assert.True(isSignaled(second))
+
+	unsubscribeSecond()
+	unsubscribeOther()
+	assert.Equal(0, broker.GetSubscribersCount())
+
+	// nobody listens
+	broker.Publish(1)
+}
+
+func TestBrokerResubscribe(t *testing.T) {
+	broker := MakeBroker()
+
+	_, unsubscribeOld := broker.Subscribe(1)
+	unsubscribeOld()
+	signals, _ := broker.Subscribe(1)
+	// calling it twice should not remove the new subscriber
+	unsubscribeOld()
+
+	broker.Publish(1)
+	require.True(t, isSignaled(signals))
+}
+
+func TestBrokerStop(t *testing.T) {
+	broker := MakeBroker()
+	broker.Stop()
+	broker.Stop()
+
+	_, isOpen := <-broker.Stopped()
+	require.False(t, isOpen)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	static "github.com/gameraccoon/telegram-spy-game-bot/staticData"
+	"net/url"
+)
+
+// getWebhookPath returns the path on our HTTP server that receives the updates,
+// it can differ from the public URL when the bot is behind a reverse proxy
+func getWebhookPath(config *static.StaticConfiguration) string {
+	if config.WebhookPath != "" {
+		return config.WebhookPath
+	}
+
+	webhookUrl, err := url.Parse(config.WebhookUrl)
+	if err != nil || webhookUrl.Path == "" {
+		return "/"
+	}
+	return webhookUrl.Path
+}